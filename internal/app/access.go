@@ -0,0 +1,114 @@
+// Copyright 2025 KDex Tech
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package app
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+
+	"kdex.dev/proxy/internal/check"
+	"kdex.dev/proxy/internal/config"
+	kctx "kdex.dev/proxy/internal/context"
+	"kdex.dev/proxy/internal/expression"
+	"kdex.dev/proxy/internal/permission"
+	"kdex.dev/proxy/internal/store/session"
+)
+
+// Access decides whether the user may use an app. The session must grant all
+// of the app's required scopes and, when permissions are defined for
+// app:<alias>, the user must be permitted to read it.
+type Access struct {
+	Checker        *check.Checker
+	FieldEvaluator *expression.FieldEvaluator
+}
+
+func NewAccess(config *config.Config) *Access {
+	return &Access{
+		Checker:        check.NewChecker(config),
+		FieldEvaluator: expression.NewFieldEvaluator(config),
+	}
+}
+
+func (a *Access) Allowed(r *http.Request, app config.App) (bool, error) {
+	if len(app.RequiredScopes) > 0 {
+		sessionData, ok := r.Context().Value(kctx.SessionDataKey).(*session.SessionData)
+		if !ok || sessionData == nil {
+			return false, nil
+		}
+
+		scopes, err := a.FieldEvaluator.EvaluateScopes(sessionData.Data)
+		if err != nil {
+			return false, fmt.Errorf("error evaluating scopes: %w", err)
+		}
+
+		for _, scope := range app.RequiredScopes {
+			if !slices.Contains(scopes, scope) {
+				return false, nil
+			}
+		}
+	}
+
+	if a.Checker == nil || a.Checker.PermissionProvider == nil {
+		return true, nil
+	}
+
+	// Users without roles may still use apps no permissions are defined for
+	resource := "app:" + app.Alias
+	if _, err := a.Checker.PermissionProvider.GetPermissions(resource); errors.Is(err, permission.ErrNoPermissions) {
+		return true, nil
+	} else if err != nil {
+		return false, fmt.Errorf("error getting app permissions: %w", err)
+	}
+
+	allowed, err := a.Checker.Check(r.Context(), resource, "read")
+	switch {
+	case errors.Is(err, check.ErrNoRoles):
+		return false, nil
+	case err != nil:
+		return false, fmt.Errorf("error checking app permissions: %w", err)
+	}
+
+	return allowed, nil
+}
+
+// Restricted reports whether the app is limited to some users: it requires
+// scopes or permissions are defined for app:<alias>.
+func (a *Access) Restricted(app config.App) bool {
+	if len(app.RequiredScopes) > 0 {
+		return true
+	}
+
+	if a.Checker == nil || a.Checker.PermissionProvider == nil {
+		return false
+	}
+
+	_, err := a.Checker.PermissionProvider.GetPermissions("app:" + app.Alias)
+	return !errors.Is(err, permission.ErrNoPermissions)
+}
+
+// DeepLinkAlias returns the alias of the app a path routes into, the segment
+// following the path separator, or "" when the path isn't a deep link.
+func DeepLinkAlias(path string, separator string) string {
+	parts := strings.SplitN(path, separator, 2)
+	if len(parts) < 2 {
+		return ""
+	}
+
+	alias, _, _ := strings.Cut(parts[1], "/")
+	return alias
+}
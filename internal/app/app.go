@@ -15,15 +15,24 @@
 package app
 
 import (
+	"encoding/json"
 	"fmt"
 	"log"
+	"maps"
 	"net/http"
+	"slices"
+	"sort"
+	"strconv"
 	"strings"
 
+	"github.com/antchfx/htmlquery"
 	"golang.org/x/net/html"
+	"kdex.dev/proxy/internal/canary"
 	"kdex.dev/proxy/internal/config"
 	kctx "kdex.dev/proxy/internal/context"
 	"kdex.dev/proxy/internal/dom"
+	"kdex.dev/proxy/internal/expression"
+	"kdex.dev/proxy/internal/store/session"
 	"kdex.dev/proxy/internal/util"
 )
 
@@ -32,13 +41,37 @@ const (
 )
 
 type AppTransformer struct {
-	Config *config.Config
+	Access    *Access
+	Config    *config.Config
+	Evaluator *expression.Evaluator
+	Health    *Health
 }
 
-func NewAppTransformer(config *config.Config) *AppTransformer {
-	return &AppTransformer{
+// NewAppTransformer uses the engine's health checks, which are nil unless
+// enabled.
+func NewAppTransformer(config *config.Config, health *Health) *AppTransformer {
+	t := &AppTransformer{
 		Config: config,
+		Health: health,
 	}
+
+	if len(config.Apps) > 0 || config.DynamicApps() {
+		t.Access = NewAccess(config)
+	}
+
+	// The CEL environment is only needed by apps computing attributes, which
+	// apps added at runtime may do.
+	computed := config.DynamicApps()
+	for _, app := range config.Apps {
+		if len(app.AttributeExpressions) > 0 || app.ConfigExpression != "" {
+			computed = true
+		}
+	}
+	if computed {
+		t.Evaluator = expression.NewEvaluator()
+	}
+
+	return t
 }
 
 func (t *AppTransformer) Transform(r *http.Response, doc *html.Node) error {
@@ -48,6 +81,11 @@ func (t *AppTransformer) Transform(r *http.Response, doc *html.Node) error {
 		return nil
 	}
 
+	variant, ok := r.Request.Context().Value(kctx.VariantKey).(kctx.Variant)
+	if !ok {
+		variant = kctx.Variant{Name: canary.Stable}
+	}
+
 	targetPath := strings.TrimSuffix(proxiedParts.ProxiedPath, "/")
 	log.Printf("Looking for apps for %s", targetPath)
 	apps := t.Config.GetAppsForTargetPath(targetPath)
@@ -58,75 +96,310 @@ func (t *AppTransformer) Transform(r *http.Response, doc *html.Node) error {
 
 	bodyNode := dom.FindElementByName("body", doc, nil)
 
+	var placements []placement
+	var err error
 	for _, app := range apps {
-		var appContainerNode *html.Node
-		for _, target := range app.Targets {
-			appContainerNode = dom.FindElementByName(KDEX_UI_APP_CONTAINER_ID, doc, func(n *html.Node) bool {
-				foundId := false
-				for _, a := range n.Attr {
-					if a.Key == "id" {
-						foundId = true
-					}
-					if a.Key == "id" && a.Val == target.Container {
-						return true
-					}
-				}
+		allowed := true
+		if t.Access != nil {
+			allowed, err = t.Access.Allowed(r.Request, app)
+			if err != nil {
+				return fmt.Errorf("error authorizing app %s: %w", app.Alias, err)
+			}
+		}
 
-				// If the containerId is not found, but the containerId is empty, we can assume that this is the default container
-				if !foundId && (target.Container == "" || target.Container == "main") {
-					return true
-				}
+		// Apps the user may not use are replaced by their placeholder and
+		// unhealthy apps by their fallback. Without that markup the upstream
+		// content of the container is kept.
+		available, substitute := true, ""
+		switch {
+		case !allowed:
+			available, substitute = false, app.Placeholder
+		case t.Health != nil && !t.Health.Healthy(app, variant.Name):
+			available, substitute = false, app.Fallback
+		}
 
-				return false
-			})
+		if !available && substitute == "" {
+			log.Printf("App %s is not available", app.Alias)
+			continue
+		}
 
-			if appContainerNode == nil {
-				log.Printf("App container for element %s targeting %s/%s not found", app.Element, target.Path, target.Container)
-				continue
+		target, appContainerNode, err := t.container(app, targetPath, doc)
+		if err != nil {
+			return err
+		}
+		if appContainerNode == nil {
+			continue
+		}
+
+		var nodes []*html.Node
+		if available {
+			customElement, err := t.element(app, r.Request, proxiedParts)
+			if err != nil {
+				return err
+			}
+			nodes = []*html.Node{customElement}
+		} else {
+			nodes, err = html.ParseFragment(strings.NewReader(substitute), appContainerNode)
+			if err != nil {
+				return fmt.Errorf("error parsing substitute markup of app %s: %w", app.Alias, err)
 			}
+		}
 
-			log.Printf("App container for element %s targeting %s/%s found", app.Element, target.Path, target.Container)
+		placements = append(placements, placement{container: appContainerNode, nodes: nodes, target: target})
 
-			// append a new custom element node to element
-			customElement := &html.Node{
+		if bodyNode != nil && available {
+			scriptNode := &html.Node{
 				Type: html.ElementNode,
-				Data: app.Element,
+				Data: "script",
 				Attr: []html.Attribute{
-					{Key: "id", Val: app.Alias},
+					{Key: "type", Val: "module"},
+					{Key: "src", Val: ScriptURL(r.Request, t.Config, app, variant.Name)},
 				},
 			}
+			bodyNode.AppendChild(scriptNode)
+		}
+	}
 
-			if app.Alias == proxiedParts.AppAlias && proxiedParts.AppPath != "" {
-				customElement.Attr = append(customElement.Attr, html.Attribute{Key: "route-path", Val: proxiedParts.AppPath})
+	place(placements)
+
+	return nil
+}
+
+// placement is the content an app contributes to a container.
+type placement struct {
+	container *html.Node
+	nodes     []*html.Node
+	target    config.Target
+}
+
+// container finds the container of the first of the app's targets for the
+// page, creating it under the target's parent when the page has none.
+func (t *AppTransformer) container(app config.App, targetPath string, doc *html.Node) (config.Target, *html.Node, error) {
+	for _, target := range app.Targets {
+		if !target.Matches(targetPath) {
+			continue
+		}
+
+		appContainerNode := dom.FindElementByName(KDEX_UI_APP_CONTAINER_ID, doc, func(n *html.Node) bool {
+			foundId := false
+			for _, a := range n.Attr {
+				if a.Key == "id" {
+					foundId = true
+				}
+				if a.Key == "id" && a.Val == target.Container {
+					return true
+				}
 			}
 
-			// remove all children of the app container node
-			for c := appContainerNode.FirstChild; c != nil; c = c.NextSibling {
-				appContainerNode.RemoveChild(c)
+			// If the containerId is not found, but the containerId is empty, we can assume that this is the default container
+			if !foundId && (target.Container == "" || target.Container == "main") {
+				return true
 			}
 
-			appContainerNode.AppendChild(customElement)
-			break
+			return false
+		})
+
+		if appContainerNode == nil && target.ParentQuery != "" {
+			parent, err := htmlquery.Query(doc, target.ParentQuery)
+			if err != nil {
+				return target, nil, fmt.Errorf("error querying container parent of app %s: %w", app.Alias, err)
+			}
+			if parent != nil {
+				appContainerNode = &html.Node{Type: html.ElementNode, Data: KDEX_UI_APP_CONTAINER_ID}
+				if target.Container != "" && target.Container != "main" {
+					appContainerNode.Attr = []html.Attribute{{Key: "id", Val: target.Container}}
+				}
+				parent.AppendChild(appContainerNode)
+				log.Printf("App container %s/%s created for element %s", target.Path, target.Container, app.Element)
+			}
 		}
 
-		if bodyNode != nil && appContainerNode != nil {
-			scriptNode := &html.Node{
-				Type: html.ElementNode,
-				Data: "script",
-				Attr: []html.Attribute{
-					{Key: "type", Val: "module"},
-					{Key: "src", Val: fmt.Sprintf(
-						"%s://%s/%s",
-						util.GetScheme(r.Request),
-						app.Address,
-						strings.TrimPrefix(app.Path, "/"),
-					)},
-				},
+		if appContainerNode == nil {
+			log.Printf("App container for element %s targeting %s/%s not found", app.Element, target.Path, target.Container)
+			continue
+		}
+
+		log.Printf("App container for element %s targeting %s/%s found", app.Element, target.Path, target.Container)
+		return target, appContainerNode, nil
+	}
+
+	return config.Target{}, nil, nil
+}
+
+// element builds the app's custom element.
+func (t *AppTransformer) element(app config.App, r *http.Request, proxiedParts kctx.ProxiedParts) (*html.Node, error) {
+	customElement := &html.Node{
+		Type: html.ElementNode,
+		Data: app.Element,
+		Attr: append([]html.Attribute{
+			{Key: "id", Val: app.Alias},
+		}, t.attributes(app, r)...),
+	}
+
+	if locale, ok := r.Context().Value(kctx.LocaleKey).(string); ok && locale != "" {
+		customElement.Attr = append(customElement.Attr, html.Attribute{Key: "locale", Val: locale})
+	}
+
+	if app.Alias == proxiedParts.AppAlias && proxiedParts.AppPath != "" {
+		customElement.Attr = append(customElement.Attr, html.Attribute{Key: "route-path", Val: proxiedParts.AppPath})
+	}
+
+	if params, ok := r.Context().Value(kctx.RouteParamsKey).(map[string]string); ok && len(params) > 0 {
+		value, err := json.Marshal(params)
+		if err != nil {
+			return nil, fmt.Errorf("error encoding route parameters: %w", err)
+		}
+		customElement.Attr = append(customElement.Attr, html.Attribute{Key: "route-params", Val: string(value)})
+	}
+
+	// The skeleton is shown until the element upgrades and renders its own
+	// content.
+	if app.Skeleton != "" {
+		skeletonNodes, err := html.ParseFragment(strings.NewReader(app.Skeleton), customElement)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing skeleton of app %s: %w", app.Alias, err)
+		}
+		for _, node := range skeletonNodes {
+			customElement.AppendChild(node)
+		}
+	}
+
+	return customElement, nil
+}
+
+// place inserts the apps into their containers by ascending order. The
+// upstream content of a container is removed when any of its apps replaces
+// it; prepended apps go before what remains and the others after it.
+func place(placements []placement) {
+	sort.SliceStable(placements, func(i, j int) bool {
+		return placements[i].target.Order < placements[j].target.Order
+	})
+
+	anchors := map[*html.Node]*html.Node{}
+	for _, p := range placements {
+		if _, ok := anchors[p.container]; ok {
+			continue
+		}
+
+		replace := slices.ContainsFunc(placements, func(other placement) bool {
+			return other.container == p.container && (other.target.Position == "" || other.target.Position == config.PositionReplace)
+		})
+		if replace {
+			for p.container.FirstChild != nil {
+				p.container.RemoveChild(p.container.FirstChild)
 			}
+		}
 
-			bodyNode.AppendChild(scriptNode)
+		anchors[p.container] = p.container.FirstChild
+	}
+
+	for _, p := range placements {
+		for _, node := range p.nodes {
+			if p.target.Position == config.PositionPrepend && anchors[p.container] != nil {
+				p.container.InsertBefore(node, anchors[p.container])
+			} else {
+				p.container.AppendChild(node)
+			}
 		}
 	}
+}
 
-	return nil
+// attributes renders the app's static attributes, the attributes computed
+// from the session claims and the request, and its JSON data-config. Values
+// are escaped when the document is rendered.
+func (t *AppTransformer) attributes(app config.App, r *http.Request) []html.Attribute {
+	attrs := []html.Attribute{}
+
+	names := util.Keys(app.Attributes)
+	sort.Strings(names)
+	for _, name := range names {
+		attrs = append(attrs, html.Attribute{Key: name, Val: app.Attributes[name]})
+	}
+
+	if t.Evaluator == nil {
+		return append(attrs, t.dataConfig(app, app.Config)...)
+	}
+
+	vars := map[string]interface{}{
+		"data":    map[string]interface{}{},
+		"request": expression.RequestData(r),
+	}
+	if sessionData, ok := r.Context().Value(kctx.SessionDataKey).(*session.SessionData); ok && sessionData != nil {
+		vars["data"] = sessionData.Data
+	}
+
+	names = util.Keys(app.AttributeExpressions)
+	sort.Strings(names)
+	for _, name := range names {
+		result, err := t.Evaluator.EvaluateWith(app.AttributeExpressions[name], vars)
+		if err != nil {
+			log.Printf("Error evaluating attribute %s of app %s: %v", name, app.Alias, err)
+			continue
+		}
+		if value, ok := attributeValue(result); ok {
+			attrs = append(attrs, html.Attribute{Key: name, Val: value})
+		}
+	}
+
+	appConfig := app.Config
+	if app.ConfigExpression != "" {
+		result, err := t.Evaluator.EvaluateWith(app.ConfigExpression, vars)
+		if err != nil {
+			log.Printf("Error evaluating config of app %s: %v", app.Alias, err)
+		} else if computed, err := expression.Native(result); err != nil {
+			log.Printf("Error converting config of app %s: %v", app.Alias, err)
+		} else if computed, ok := computed.(map[string]interface{}); ok {
+			appConfig = maps.Clone(appConfig)
+			if appConfig == nil {
+				appConfig = map[string]interface{}{}
+			}
+			maps.Copy(appConfig, computed)
+		} else {
+			log.Printf("Config of app %s must evaluate to a map; got %T", app.Alias, result)
+		}
+	}
+
+	return append(attrs, t.dataConfig(app, appConfig)...)
+}
+
+func (t *AppTransformer) dataConfig(app config.App, appConfig map[string]interface{}) []html.Attribute {
+	if len(appConfig) == 0 {
+		return nil
+	}
+
+	value, err := json.Marshal(appConfig)
+	if err != nil {
+		log.Printf("Error encoding config of app %s: %v", app.Alias, err)
+		return nil
+	}
+
+	return []html.Attribute{{Key: "data-config", Val: string(value)}}
+}
+
+// attributeValue maps an expression result to an attribute value. true
+// renders a boolean attribute, while false and null omit the attribute.
+func attributeValue(result interface{}) (string, bool) {
+	value, err := expression.Native(result)
+	if err != nil {
+		return "", false
+	}
+
+	switch v := value.(type) {
+	case nil:
+		return "", false
+	case bool:
+		return "", v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), true
+	case string:
+		return v, true
+	case []interface{}, map[string]interface{}:
+		value, err := json.Marshal(v)
+		if err != nil {
+			return "", false
+		}
+		return string(value), true
+	default:
+		return fmt.Sprint(v), true
+	}
 }
@@ -15,16 +15,22 @@
 package app
 
 import (
+	"compress/gzip"
 	"context"
 	"net/http"
 	"net/http/httptest"
 	"reflect"
+	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"golang.org/x/net/html"
+	"kdex.dev/proxy/internal/canary"
 	"kdex.dev/proxy/internal/config"
 	kctx "kdex.dev/proxy/internal/context"
+	"kdex.dev/proxy/internal/store/session"
 	"kdex.dev/proxy/internal/util"
 )
 
@@ -145,6 +151,62 @@ func TestValidateApp(t *testing.T) {
 			},
 			wantErr: false,
 		},
+		{
+			name: "invalid attribute name",
+			args: args{
+				app: &config.App{Address: "sample-app", Element: "sample-element", Path: "sample-path", Targets: []config.Target{{Path: "sample-page"}}, Attributes: map[string]string{"bad name": "x"}},
+			},
+			wantErr: true,
+		},
+		{
+			name: "reserved attribute name",
+			args: args{
+				app: &config.App{Address: "sample-app", Element: "sample-element", Path: "sample-path", Targets: []config.Target{{Path: "sample-page"}}, AttributeExpressions: map[string]string{"id": "data.sub"}},
+			},
+			wantErr: true,
+		},
+		{
+			name: "event handler attribute",
+			args: args{
+				app: &config.App{Address: "sample-app", Element: "sample-element", Path: "sample-path", Targets: []config.Target{{Path: "sample-page"}}, AttributeExpressions: map[string]string{"OnClick": "data.name"}},
+			},
+			wantErr: true,
+		},
+		{
+			name: "unsafe attribute",
+			args: args{
+				app: &config.App{Address: "sample-app", Element: "sample-element", Path: "sample-path", Targets: []config.Target{{Path: "sample-page"}}, Attributes: map[string]string{"srcdoc": "<script></script>"}},
+			},
+			wantErr: true,
+		},
+		{
+			name: "invalid position",
+			args: args{
+				app: &config.App{Address: "sample-app", Element: "sample-element", Path: "sample-path", Targets: []config.Target{{Path: "sample-page", Position: "before"}}},
+			},
+			wantErr: true,
+		},
+		{
+			name: "relative health path",
+			args: args{
+				app: &config.App{Address: "sample-app", Element: "sample-element", Path: "sample-path", Targets: []config.Target{{Path: "sample-page"}}, HealthPath: "healthz"},
+			},
+			wantErr: true,
+		},
+		{
+			name: "invalid alias",
+			args: args{
+				app: &config.App{Address: "sample-app", Alias: "sample@canary", Element: "sample-element", Path: "sample-path", Targets: []config.Target{{Path: "sample-page"}}},
+			},
+			wantErr: true,
+		},
+		{
+			name: "valid attributes",
+			args: args{
+				app: &config.App{Address: "sample-app", Element: "sample-element", Path: "sample-path", Targets: []config.Target{{Path: "sample-page"}}, Attributes: map[string]string{"theme": "dark"}, AttributeExpressions: map[string]string{"user-name": "data.name"}},
+			},
+			wantErr: false,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -327,6 +389,50 @@ func TestAppTransformer_Transform(t *testing.T) {
 	}
 }
 
+func TestAppTransformer_Transform_attributes(t *testing.T) {
+	app := config.App{
+		Address: "test-app",
+		Alias:   "ta",
+		Element: "test-app",
+		Path:    "/app.js",
+		Targets: []config.Target{{Path: "/posts"}},
+		Attributes: map[string]string{
+			"theme": "dark",
+			"title": `"quoted" <value>`,
+		},
+		AttributeExpressions: map[string]string{
+			"admin":     `"admin" in data.roles`,
+			"anonymous": `!has(data.sub)`,
+			"groups":    `data.roles`,
+			"user-name": `data.name`,
+			"broken":    `data.nope.deeper`,
+		},
+		Config:           map[string]interface{}{"api": "/api", "page": 1},
+		ConfigExpression: `{"page": 2, "user": data.name}`,
+	}
+
+	transformer := NewAppTransformer(&config.Config{Apps: []config.App{app}}, nil)
+	assert.NotNil(t, transformer.Evaluator)
+
+	ctx := context.WithValue(context.Background(), kctx.ProxiedPartsKey, kctx.ProxiedParts{ProxiedPath: "/posts"})
+	ctx = context.WithValue(ctx, kctx.SessionDataKey, &session.SessionData{
+		Data: map[string]interface{}{
+			"name":  "Jane",
+			"roles": []interface{}{"admin", "user"},
+			"sub":   "jane",
+		},
+	})
+	r := httptest.NewRequestWithContext(ctx, "GET", "/", nil)
+	r.URL.Scheme = "http"
+
+	doc := util.ToDoc(`<html><head></head><body><kdex-ui-app-container></kdex-ui-app-container></body></html>`)
+	assert.NoError(t, transformer.Transform(&http.Response{Request: r}, doc))
+	assert.Equal(t,
+		`<html><head></head><body><kdex-ui-app-container><test-app id="ta" theme="dark" title="&#34;quoted&#34; &lt;value&gt;" admin="" groups="[&#34;admin&#34;,&#34;user&#34;]" user-name="Jane" data-config="{&#34;api&#34;:&#34;/api&#34;,&#34;page&#34;:2,&#34;user&#34;:&#34;Jane&#34;}"></test-app></kdex-ui-app-container><script type="module" src="http://test-app/app.js"></script></body></html>`,
+		util.FromDoc(doc),
+	)
+}
+
 func TestNewAppTransformer(t *testing.T) {
 	type args struct {
 		config *config.Config
@@ -346,9 +452,438 @@ func TestNewAppTransformer(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			if got := NewAppTransformer(tt.args.config); !reflect.DeepEqual(got, tt.want) {
+			if got := NewAppTransformer(tt.args.config, nil); !reflect.DeepEqual(got, tt.want) {
 				t.Errorf("NewAppTransformer() = %v, want %v", got, tt.want)
 			}
 		})
 	}
 }
+
+func TestAppTransformer_Transform_access(t *testing.T) {
+	apps := []config.App{
+		{Address: "open-app", Alias: "oa", Element: "open-app", Path: "/app.js", Targets: []config.Target{{Path: "/posts", Container: "open"}}},
+		{Address: "scoped-app", Alias: "sa", Element: "scoped-app", Path: "/app.js", RequiredScopes: []string{"billing"}, Targets: []config.Target{{Path: "/posts", Container: "scoped"}}},
+		{Address: "admin-app", Alias: "aa", Element: "admin-app", Path: "/app.js", Placeholder: `<p class="denied">Ask for access</p>`, Targets: []config.Target{{Path: "/posts", Container: "admin"}}},
+	}
+	page := `<html><head></head><body><kdex-ui-app-container id="open"></kdex-ui-app-container><kdex-ui-app-container id="scoped"></kdex-ui-app-container><kdex-ui-app-container id="admin"><div></div></kdex-ui-app-container></body></html>`
+
+	tests := []struct {
+		name    string
+		session *session.SessionData
+		roles   []string
+		want    string
+	}{
+		{
+			name: "no roles",
+			want: `<html><head></head><body><kdex-ui-app-container id="open"><open-app id="oa"></open-app></kdex-ui-app-container><kdex-ui-app-container id="scoped"></kdex-ui-app-container><kdex-ui-app-container id="admin"><p class="denied">Ask for access</p></kdex-ui-app-container><script type="module" src="http://open-app/app.js"></script></body></html>`,
+		},
+		{
+			name:  "anonymous",
+			roles: []string{"anonymous"},
+			want:  `<html><head></head><body><kdex-ui-app-container id="open"><open-app id="oa"></open-app></kdex-ui-app-container><kdex-ui-app-container id="scoped"></kdex-ui-app-container><kdex-ui-app-container id="admin"><p class="denied">Ask for access</p></kdex-ui-app-container><script type="module" src="http://open-app/app.js"></script></body></html>`,
+		},
+		{
+			name:    "scoped user",
+			session: &session.SessionData{Data: map[string]interface{}{"scope": "openid billing"}},
+			roles:   []string{"user"},
+			want:    `<html><head></head><body><kdex-ui-app-container id="open"><open-app id="oa"></open-app></kdex-ui-app-container><kdex-ui-app-container id="scoped"><scoped-app id="sa"></scoped-app></kdex-ui-app-container><kdex-ui-app-container id="admin"><p class="denied">Ask for access</p></kdex-ui-app-container><script type="module" src="http://open-app/app.js"></script><script type="module" src="http://scoped-app/app.js"></script></body></html>`,
+		},
+		{
+			name:    "admin without scopes",
+			session: &session.SessionData{Data: map[string]interface{}{"scope": "openid"}},
+			roles:   []string{"admin"},
+			want:    `<html><head></head><body><kdex-ui-app-container id="open"><open-app id="oa"></open-app></kdex-ui-app-container><kdex-ui-app-container id="scoped"></kdex-ui-app-container><kdex-ui-app-container id="admin"><admin-app id="aa"></admin-app></kdex-ui-app-container><script type="module" src="http://open-app/app.js"></script><script type="module" src="http://admin-app/app.js"></script></body></html>`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &config.Config{
+				Apps: apps,
+				Authz: config.AuthzConfig{
+					Provider: "static",
+					Static: config.StaticAuthzProviderConfig{
+						Permissions: []config.Permission{
+							{Action: "read", Principal: "admin", Resource: "app:aa"},
+						},
+					},
+				},
+				Expressions: config.ExpressionsConfig{Scopes: `has(data.scope) ? data.scope : ""`},
+			}
+			transformer := NewAppTransformer(c, nil)
+
+			ctx := context.WithValue(context.Background(), kctx.ProxiedPartsKey, kctx.ProxiedParts{ProxiedPath: "/posts"})
+			ctx = context.WithValue(ctx, kctx.UserRolesKey, tt.roles)
+			if tt.session != nil {
+				ctx = context.WithValue(ctx, kctx.SessionDataKey, tt.session)
+			}
+			r := httptest.NewRequestWithContext(ctx, "GET", "/", nil)
+			r.URL.Scheme = "http"
+
+			doc := util.ToDoc(page)
+			assert.NoError(t, transformer.Transform(&http.Response{Request: r}, doc))
+			assert.Equal(t, tt.want, util.FromDoc(doc))
+		})
+	}
+}
+
+func TestDeepLinkAlias(t *testing.T) {
+	assert.Equal(t, "", DeepLinkAlias("/posts", "/_/"))
+	assert.Equal(t, "ta", DeepLinkAlias("/posts/_/ta", "/_/"))
+	assert.Equal(t, "ta", DeepLinkAlias("/posts/_/ta/orders/1", "/_/"))
+}
+
+func TestAssetProxy_ServeHTTP(t *testing.T) {
+	requests := 0
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		assert.Empty(t, r.Header.Get("Cookie"))
+		switch r.URL.Path {
+		case "/dist/app.js":
+			w.Header().Set("Content-Type", "text/javascript")
+			w.Header().Set("ETag", `"v1"`)
+			w.Write([]byte("export default 1;"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer backend.Close()
+
+	c := &config.Config{
+		AppAssets: config.AppAssetsConfig{
+			Cache:        config.CacheConfig{Type: "memory", TTL: time.Minute},
+			CacheControl: "public, max-age=60",
+			Enabled:      true,
+			Prefix:       "/~/apps/",
+			Scheme:       "http",
+		},
+		Apps: []config.App{
+			{Address: strings.TrimPrefix(backend.URL, "http://"), Alias: "ta", Element: "test-app", Path: "/dist/app.js", Targets: []config.Target{{Path: "/posts"}}},
+			{Address: strings.TrimPrefix(backend.URL, "http://"), Alias: "sa", Element: "scoped-app", Path: "/dist/app.js", RequiredScopes: []string{"billing"}, Targets: []config.Target{{Path: "/posts"}}},
+		},
+	}
+	p := NewAssetProxy(c)
+
+	serve := func(path string) *httptest.ResponseRecorder {
+		request := httptest.NewRequest("GET", path, nil)
+		request.Header.Set("Cookie", "session=secret")
+		recorder := httptest.NewRecorder()
+		p.ServeHTTP(recorder, request)
+		return recorder
+	}
+
+	recorder := serve("/~/apps/ta/dist/app.js")
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, "export default 1;", recorder.Body.String())
+	assert.Equal(t, "public, max-age=60", recorder.Header().Get("Cache-Control"))
+
+	recorder = serve("/~/apps/ta/dist/app.js")
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, "export default 1;", recorder.Body.String())
+	assert.Equal(t, "text/javascript", recorder.Header().Get("Content-Type"))
+	assert.Equal(t, 1, requests, "second request is served from the cache")
+
+	assert.Equal(t, http.StatusNotFound, serve("/~/apps/ta/missing.js").Code)
+	assert.Equal(t, http.StatusNotFound, serve("/~/apps/xx/dist/app.js").Code)
+	assert.Equal(t, http.StatusForbidden, serve("/~/apps/sa/dist/app.js").Code)
+}
+
+func TestAssetProxy_ServeHTTP_encoding(t *testing.T) {
+	requests := 0
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Header().Set("Content-Type", "text/javascript")
+		switch {
+		case r.URL.Path == "/dist/app.br.js":
+			w.Header().Set("Content-Encoding", "br")
+			w.Write([]byte("brotli"))
+		case strings.Contains(r.Header.Get("Accept-Encoding"), "gzip"):
+			w.Header().Set("Content-Encoding", "gzip")
+			gz := gzip.NewWriter(w)
+			gz.Write([]byte("export default 1;"))
+			gz.Close()
+		default:
+			w.Write([]byte("export default 1;"))
+		}
+	}))
+	defer backend.Close()
+
+	c := &config.Config{
+		AppAssets: config.AppAssetsConfig{
+			Cache:   config.CacheConfig{Type: "memory", TTL: time.Minute},
+			Enabled: true,
+			Prefix:  "/~/apps/",
+			Scheme:  "http",
+		},
+		Apps: []config.App{
+			{Address: strings.TrimPrefix(backend.URL, "http://"), Alias: "ta", Element: "test-app", Path: "/dist/app.js", Targets: []config.Target{{Path: "/posts"}}},
+		},
+	}
+	p := NewAssetProxy(c)
+
+	serve := func(path string, acceptEncoding string) *httptest.ResponseRecorder {
+		request := httptest.NewRequest("GET", path, nil)
+		if acceptEncoding != "" {
+			request.Header.Set("Accept-Encoding", acceptEncoding)
+		}
+		recorder := httptest.NewRecorder()
+		p.ServeHTTP(recorder, request)
+		return recorder
+	}
+
+	recorder := serve("/~/apps/ta/dist/app.js", "gzip, br")
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Empty(t, recorder.Header().Get("Content-Encoding"))
+	assert.Equal(t, "export default 1;", recorder.Body.String())
+
+	recorder = serve("/~/apps/ta/dist/app.js", "")
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Empty(t, recorder.Header().Get("Content-Encoding"))
+	assert.Equal(t, "export default 1;", recorder.Body.String())
+	assert.Equal(t, 1, requests, "the decoded body is replayed from the cache")
+
+	for range 2 {
+		recorder = serve("/~/apps/ta/dist/app.br.js", "br")
+		assert.Equal(t, "br", recorder.Header().Get("Content-Encoding"))
+		assert.Equal(t, "brotli", recorder.Body.String())
+	}
+	assert.Equal(t, 3, requests, "bodies encoded unasked aren't cached")
+}
+
+func TestAssetProxy_ServeHTTP_restricted(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/dist/admin.js" {
+			w.Header().Set("Cache-Control", "public, max-age=30")
+		}
+		w.Header().Set("Content-Type", "text/javascript")
+		w.Write([]byte("export default 1;"))
+	}))
+	defer backend.Close()
+	address := strings.TrimPrefix(backend.URL, "http://")
+
+	c := &config.Config{
+		AppAssets: config.AppAssetsConfig{
+			Cache:        config.CacheConfig{Type: "memory", TTL: time.Minute},
+			CacheControl: "public, max-age=60",
+			Enabled:      true,
+			Prefix:       "/~/apps/",
+			Scheme:       "http",
+		},
+		Apps: []config.App{
+			{Address: address, Alias: "ta", Element: "test-app", Path: "/dist/app.js", Targets: []config.Target{{Path: "/posts"}}},
+			{Address: address, Alias: "aa", Element: "admin-app", Path: "/dist/admin.js", Targets: []config.Target{{Path: "/posts"}}},
+		},
+		Authz: config.AuthzConfig{
+			Provider: "static",
+			Static: config.StaticAuthzProviderConfig{
+				Permissions: []config.Permission{
+					{Action: "read", Principal: "admin", Resource: "app:aa"},
+				},
+			},
+		},
+	}
+	p := NewAssetProxy(c)
+
+	serve := func(path string) *httptest.ResponseRecorder {
+		ctx := context.WithValue(context.Background(), kctx.UserRolesKey, []string{"admin"})
+		recorder := httptest.NewRecorder()
+		p.ServeHTTP(recorder, httptest.NewRequestWithContext(ctx, "GET", path, nil))
+		return recorder
+	}
+
+	assert.Equal(t, "public, max-age=60", serve("/~/apps/ta/dist/app.js").Header().Get("Cache-Control"))
+
+	recorder := serve("/~/apps/aa/dist/admin.js")
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, "private, max-age=30", recorder.Header().Get("Cache-Control"))
+
+	recorder = serve("/~/apps/aa/dist/admin.js")
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, "private, max-age=60", recorder.Header().Get("Cache-Control"), "cached entries of restricted apps stay private")
+}
+
+func TestScriptURL(t *testing.T) {
+	app := config.App{Address: "test-app:8080", Alias: "ta", CanaryAddress: "test-app-canary:8080", Path: "/dist/app.js"}
+	r := httptest.NewRequest("GET", "https://example.com/posts", nil)
+
+	c := &config.Config{}
+	assert.Equal(t, "https://test-app:8080/dist/app.js", ScriptURL(r, c, app, canary.Stable))
+	assert.Equal(t, "https://test-app-canary:8080/dist/app.js", ScriptURL(r, c, app, canary.Canary))
+
+	c.AppAssets = config.AppAssetsConfig{Enabled: true, Prefix: "/~/apps/"}
+	assert.Equal(t, "/~/apps/ta/dist/app.js", ScriptURL(r, c, app, canary.Stable))
+	assert.Equal(t, "/~/apps/ta@canary/dist/app.js", ScriptURL(r, c, app, canary.Canary))
+}
+
+func TestAppTransformer_Transform_health(t *testing.T) {
+	healthy := true
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !healthy {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer backend.Close()
+	address := strings.TrimPrefix(backend.URL, "http://")
+
+	c := &config.Config{
+		AppHealth: config.AppHealthConfig{Scheme: "http", Timeout: time.Second},
+		Apps: []config.App{
+			{Address: address, Alias: "fa", Element: "fallback-app", Path: "/app.js", HealthPath: "/healthz", Fallback: `<p>Unavailable</p>`, Skeleton: `<div class="skeleton"></div>`, Targets: []config.Target{{Path: "/posts", Container: "first"}}},
+			{Address: address, Alias: "ka", Element: "kept-app", Path: "/app.js", HealthPath: "/healthz", Targets: []config.Target{{Path: "/posts", Container: "second"}}},
+		},
+	}
+	page := `<html><head></head><body><kdex-ui-app-container id="first"></kdex-ui-app-container><kdex-ui-app-container id="second"><p>Upstream</p></kdex-ui-app-container></body></html>`
+
+	tests := []struct {
+		name    string
+		healthy bool
+		want    string
+	}{
+		{
+			name:    "healthy",
+			healthy: true,
+			want:    `<html><head></head><body><kdex-ui-app-container id="first"><fallback-app id="fa"><div class="skeleton"></div></fallback-app></kdex-ui-app-container><kdex-ui-app-container id="second"><kept-app id="ka"></kept-app></kdex-ui-app-container><script type="module" src="http://` + address + `/app.js"></script><script type="module" src="http://` + address + `/app.js"></script></body></html>`,
+		},
+		{
+			name:    "unhealthy",
+			healthy: false,
+			want:    `<html><head></head><body><kdex-ui-app-container id="first"><p>Unavailable</p></kdex-ui-app-container><kdex-ui-app-container id="second"><p>Upstream</p></kdex-ui-app-container></body></html>`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			healthy = tt.healthy
+			health := &Health{Config: c, client: backend.Client(), unhealthy: map[string]bool{}}
+			health.Check(context.Background())
+
+			transformer := &AppTransformer{Config: c, Health: health}
+
+			ctx := context.WithValue(context.Background(), kctx.ProxiedPartsKey, kctx.ProxiedParts{ProxiedPath: "/posts"})
+			r := httptest.NewRequestWithContext(ctx, "GET", "/", nil)
+			r.URL.Scheme = "http"
+
+			doc := util.ToDoc(page)
+			assert.NoError(t, transformer.Transform(&http.Response{Request: r}, doc))
+			assert.Equal(t, tt.want, util.FromDoc(doc))
+		})
+	}
+}
+
+func TestHealth_Start(t *testing.T) {
+	var probes atomic.Int32
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		probes.Add(1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer backend.Close()
+
+	c := &config.Config{
+		AppHealth: config.AppHealthConfig{Interval: 10 * time.Millisecond, Scheme: "http", Timeout: time.Second},
+		Apps: []config.App{
+			{Address: strings.TrimPrefix(backend.URL, "http://"), Alias: "ta", Element: "test-app", Path: "/app.js", HealthPath: "/healthz"},
+		},
+	}
+	health := NewHealth(c)
+	assert.NotNil(t, health)
+	assert.Zero(t, probes.Load(), "nothing is checked until started")
+
+	health.Start(context.Background())
+	assert.Eventually(t, func() bool { return probes.Load() >= 2 }, time.Second, 5*time.Millisecond)
+	assert.False(t, health.Healthy(c.Apps[0], canary.Stable))
+
+	health.Stop()
+	time.Sleep(20 * time.Millisecond)
+	stopped := probes.Load()
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(t, stopped, probes.Load(), "no checks after Stop")
+}
+
+func TestAppTransformer_Transform_placement(t *testing.T) {
+	app := func(alias string, target config.Target) config.App {
+		target.Path = "/posts"
+		return config.App{Address: alias, Alias: alias, Element: alias + "-app", Path: "/app.js", Targets: []config.Target{target}}
+	}
+	scripts := func(aliases ...string) string {
+		s := ""
+		for _, alias := range aliases {
+			s += `<script type="module" src="http://` + alias + `/app.js"></script>`
+		}
+		return s
+	}
+
+	tests := []struct {
+		name string
+		apps []config.App
+		page string
+		want string
+	}{
+		{
+			name: "replace removes every upstream child",
+			apps: []config.App{app("a", config.Target{})},
+			page: `<html><head></head><body><kdex-ui-app-container><p>1</p><p>2</p><p>3</p></kdex-ui-app-container></body></html>`,
+			want: `<html><head></head><body><kdex-ui-app-container><a-app id="a"></a-app></kdex-ui-app-container>` + scripts("a") + `</body></html>`,
+		},
+		{
+			name: "apps share a container by order",
+			apps: []config.App{
+				app("a", config.Target{Order: 2}),
+				app("b", config.Target{Order: 1}),
+				app("c", config.Target{Order: 2}),
+			},
+			page: `<html><head></head><body><kdex-ui-app-container><p>upstream</p></kdex-ui-app-container></body></html>`,
+			want: `<html><head></head><body><kdex-ui-app-container><b-app id="b"></b-app><a-app id="a"></a-app><c-app id="c"></c-app></kdex-ui-app-container>` + scripts("a", "b", "c") + `</body></html>`,
+		},
+		{
+			name: "append and prepend keep upstream content",
+			apps: []config.App{
+				app("a", config.Target{Position: config.PositionAppend}),
+				app("b", config.Target{Position: config.PositionPrepend, Order: 2}),
+				app("c", config.Target{Position: config.PositionPrepend, Order: 1}),
+			},
+			page: `<html><head></head><body><kdex-ui-app-container><p>upstream</p></kdex-ui-app-container></body></html>`,
+			want: `<html><head></head><body><kdex-ui-app-container><c-app id="c"></c-app><b-app id="b"></b-app><p>upstream</p><a-app id="a"></a-app></kdex-ui-app-container>` + scripts("a", "b", "c") + `</body></html>`,
+		},
+		{
+			name: "container is created under its parent",
+			apps: []config.App{
+				app("a", config.Target{Container: "side", ParentQuery: "//aside"}),
+				app("b", config.Target{Container: "side", ParentQuery: "//aside", Position: config.PositionAppend}),
+				app("c", config.Target{Container: "missing", ParentQuery: "//nav"}),
+			},
+			page: `<html><head></head><body><aside><h2>Related</h2></aside></body></html>`,
+			want: `<html><head></head><body><aside><h2>Related</h2><kdex-ui-app-container id="side"><a-app id="a"></a-app><b-app id="b"></b-app></kdex-ui-app-container></aside>` + scripts("a", "b") + `</body></html>`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			transformer := &AppTransformer{Config: &config.Config{Apps: tt.apps}}
+
+			ctx := context.WithValue(context.Background(), kctx.ProxiedPartsKey, kctx.ProxiedParts{ProxiedPath: "/posts"})
+			r := httptest.NewRequestWithContext(ctx, "GET", "/", nil)
+			r.URL.Scheme = "http"
+
+			doc := util.ToDoc(tt.page)
+			assert.NoError(t, transformer.Transform(&http.Response{Request: r}, doc))
+			assert.Equal(t, tt.want, util.FromDoc(doc))
+		})
+	}
+}
+
+func TestAppTransformer_Transform_routeParams(t *testing.T) {
+	transformer := &AppTransformer{Config: &config.Config{
+		Apps: []config.App{
+			{Address: "reviews", Alias: "ra", Element: "reviews-app", Path: "/app.js", Targets: []config.Target{{Path: "/products/{id}/reviews"}}},
+		},
+	}}
+
+	ctx := context.WithValue(context.Background(), kctx.ProxiedPartsKey, kctx.ProxiedParts{AppAlias: "ra", AppPath: "/latest", ProxiedPath: "/products/42/reviews/"})
+	ctx = context.WithValue(ctx, kctx.RouteParamsKey, map[string]string{"id": "42"})
+	r := httptest.NewRequestWithContext(ctx, "GET", "/", nil)
+	r.URL.Scheme = "http"
+
+	doc := util.ToDoc(`<html><head></head><body><kdex-ui-app-container></kdex-ui-app-container></body></html>`)
+	assert.NoError(t, transformer.Transform(&http.Response{Request: r}, doc))
+	assert.Equal(t,
+		`<html><head></head><body><kdex-ui-app-container><reviews-app id="ra" route-path="/latest" route-params="{&#34;id&#34;:&#34;42&#34;}"></reviews-app></kdex-ui-app-container><script type="module" src="http://reviews/app.js"></script></body></html>`,
+		util.FromDoc(doc),
+	)
+}
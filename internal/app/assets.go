@@ -0,0 +1,257 @@
+// Copyright 2025 KDex Tech
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package app
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+	"time"
+
+	"kdex.dev/proxy/internal/canary"
+	"kdex.dev/proxy/internal/config"
+	"kdex.dev/proxy/internal/store/cache"
+	"kdex.dev/proxy/internal/util"
+)
+
+// ScriptURL returns the URL the browser loads the app's module from. When app
+// assets are served same-origin it is under the assets prefix, with the
+// canary variant recorded in the path so relative imports stay on it.
+func ScriptURL(r *http.Request, c *config.Config, app config.App, variant string) string {
+	path := strings.TrimPrefix(app.Path, "/")
+
+	if c.AppAssets.Enabled {
+		return AssetsURL(c, app, variant) + path
+	}
+
+	return fmt.Sprintf("%s://%s/%s", util.GetScheme(r), canary.AppAddress(app, variant), path)
+}
+
+// AssetsURL returns the same-origin directory of the app's assets.
+func AssetsURL(c *config.Config, app config.App, variant string) string {
+	segment := app.Alias
+	if variant == canary.Canary && app.CanaryAddress != "" {
+		segment += "@" + canary.Canary
+	}
+	return c.AppAssets.Prefix + segment + "/"
+}
+
+// ScopeURL returns the importmap scope of the modules the app loads: its
+// same-origin assets directory, or its origin otherwise.
+func ScopeURL(r *http.Request, c *config.Config, app config.App, variant string) string {
+	if c.AppAssets.Enabled {
+		return AssetsURL(c, app, variant)
+	}
+
+	return fmt.Sprintf("%s://%s/", util.GetScheme(r), canary.AppAddress(app, variant))
+}
+
+// AssetProxy serves app assets same-origin: /<prefix>/<alias>/<path> is
+// fetched from <scheme>://<app address>/<path>. Users that may not use an
+// app can't load its assets either.
+type AssetProxy struct {
+	Access *Access
+	Config *config.Config
+	cache  *cache.CacheStore
+	proxy  *httputil.ReverseProxy
+}
+
+// NewAssetProxy returns nil unless app assets are enabled.
+func NewAssetProxy(c *config.Config) *AssetProxy {
+	if !c.AppAssets.Enabled {
+		return nil
+	}
+
+	if !strings.HasPrefix(c.AppAssets.Prefix, "/") || !strings.HasSuffix(c.AppAssets.Prefix, "/") {
+		log.Fatalf("Invalid app assets prefix %q: it must start and end with /", c.AppAssets.Prefix)
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.ResponseHeaderTimeout = c.AppAssets.Timeout
+
+	p := &AssetProxy{
+		Access: NewAccess(c),
+		Config: c,
+	}
+
+	if c.AppAssets.Cache.Type == "memory" {
+		store := cache.NewMemoryCacheStore(c.AppAssets.Cache.TTL)
+		p.cache = &store
+	}
+
+	p.proxy = &httputil.ReverseProxy{
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+			log.Printf("Error proxying app asset %s: %v", r.URL.Path, err)
+			http.Error(w, "Bad Gateway", http.StatusBadGateway)
+		},
+		ModifyResponse: p.modifyResponse,
+		Rewrite:        p.rewrite,
+		Transport:      transport,
+	}
+
+	return p
+}
+
+type assetTarget struct {
+	app     config.App
+	key     string
+	path    string
+	variant string
+}
+
+type assetTargetKey struct{}
+
+func (p *AssetProxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	segment, path, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, p.Config.AppAssets.Prefix), "/")
+	alias, variant, _ := strings.Cut(segment, "@")
+	if variant != canary.Canary {
+		variant = canary.Stable
+	}
+
+	app, ok := p.Config.GetAppByAlias(alias)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	allowed, err := p.Access.Allowed(r, app)
+	if err != nil {
+		log.Printf("Error authorizing app %s: %v", alias, err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !allowed {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	target := assetTarget{
+		app:     app,
+		key:     fmt.Sprintf("%s@%s/%s?%s", app.Alias, variant, path, r.URL.RawQuery),
+		path:    "/" + path,
+		variant: variant,
+	}
+
+	if p.cache != nil && r.Method == http.MethodGet {
+		if entry, _ := (*p.cache).Get(r.Context(), target.key); entry != nil {
+			p.serveEntry(w, r, app, entry)
+			return
+		}
+	}
+
+	p.proxy.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), assetTargetKey{}, target)))
+}
+
+// rewrite sends the request to the app backend.
+func (p *AssetProxy) rewrite(pr *httputil.ProxyRequest) {
+	target := pr.In.Context().Value(assetTargetKey{}).(assetTarget)
+
+	pr.SetURL(&url.URL{
+		Scheme: p.Config.AppAssets.Scheme,
+		Host:   canary.AppAddress(target.app, target.variant),
+	})
+	pr.Out.URL.Path = target.path
+	pr.Out.URL.RawPath = ""
+	pr.Out.URL.RawQuery = pr.In.URL.RawQuery
+	pr.SetXForwarded()
+
+	// The transport negotiates gzip itself and decodes it, so the cache only
+	// holds bodies every client can read.
+	pr.Out.Header.Del("Accept-Encoding")
+
+	if !p.Config.AppAssets.ForwardCredentials {
+		pr.Out.Header.Del("Authorization")
+		pr.Out.Header.Del("Cookie")
+	}
+}
+
+func (p *AssetProxy) modifyResponse(r *http.Response) error {
+	if !p.Config.AppAssets.ForwardCredentials {
+		r.Header.Del("Set-Cookie")
+	}
+
+	target, ok := r.Request.Context().Value(assetTargetKey{}).(assetTarget)
+
+	cacheControl := r.Header.Get("Cache-Control")
+	if cacheControl == "" {
+		cacheControl = p.Config.AppAssets.CacheControl
+	}
+	if ok {
+		cacheControl = p.cacheControl(target.app, cacheControl)
+	}
+	if cacheControl != "" {
+		r.Header.Set("Cache-Control", cacheControl)
+	}
+
+	if p.cache == nil || !ok || r.Request.Method != http.MethodGet || r.StatusCode != http.StatusOK {
+		return nil
+	}
+
+	// Encodings the backend applies unasked aren't cached, since cache
+	// entries don't record them.
+	if r.Header.Get("Content-Encoding") != "" {
+		return nil
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read app asset: %w", err)
+	}
+	r.Body.Close()
+	r.Body = io.NopCloser(bytes.NewReader(body))
+
+	(*p.cache).Set(r.Request.Context(), target.key, cache.CacheEntry{
+		Content:     body,
+		ContentType: r.Header.Get("Content-Type"),
+		CreatedAt:   time.Now(),
+		ETag:        r.Header.Get("ETag"),
+		StatusCode:  r.StatusCode,
+	})
+
+	return nil
+}
+
+func (p *AssetProxy) serveEntry(w http.ResponseWriter, r *http.Request, app config.App, entry *cache.CacheEntry) {
+	if entry.ETag != "" {
+		w.Header().Set("ETag", entry.ETag)
+		if r.Header.Get("If-None-Match") == entry.ETag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+	}
+	if entry.ContentType != "" {
+		w.Header().Set("Content-Type", entry.ContentType)
+	}
+	if cacheControl := p.cacheControl(app, p.Config.AppAssets.CacheControl); cacheControl != "" {
+		w.Header().Set("Cache-Control", cacheControl)
+	}
+	w.WriteHeader(entry.StatusCode)
+	w.Write(entry.Content)
+}
+
+// cacheControl keeps the assets of restricted apps out of shared caches,
+// whatever the app backend or the configuration allow.
+func (p *AssetProxy) cacheControl(app config.App, value string) string {
+	if p.Access.Restricted(app) {
+		return util.PrivateCacheControl(value)
+	}
+	return value
+}
@@ -0,0 +1,155 @@
+// Copyright 2025 KDex Tech
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package app
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"kdex.dev/proxy/internal/canary"
+	"kdex.dev/proxy/internal/config"
+)
+
+// Health tracks whether app backends pass their health checks. Apps without
+// a health path, and apps that haven't been checked yet, count as healthy.
+type Health struct {
+	Config    *config.Config
+	cancel    context.CancelFunc
+	client    *http.Client
+	mu        sync.RWMutex
+	unhealthy map[string]bool
+}
+
+// NewHealth returns nil when no app declares a health path and no apps can
+// be added at runtime.
+func NewHealth(c *config.Config) *Health {
+	checked := c.DynamicApps()
+	for _, app := range c.Apps {
+		if app.HealthPath != "" {
+			checked = true
+		}
+	}
+	if !checked {
+		return nil
+	}
+
+	if c.AppHealth.Interval <= 0 {
+		log.Fatalf("Invalid app health interval: %v", c.AppHealth.Interval)
+	}
+
+	return &Health{
+		Config: c,
+		client: &http.Client{
+			Timeout: c.AppHealth.Timeout,
+		},
+		unhealthy: map[string]bool{},
+	}
+}
+
+// Start checks the backends in the background now and then every interval,
+// until Stop is called or the context is done.
+func (h *Health) Start(ctx context.Context) {
+	ctx, h.cancel = context.WithCancel(ctx)
+
+	go func() {
+		ticker := time.NewTicker(h.Config.AppHealth.Interval)
+		defer ticker.Stop()
+
+		for {
+			h.Check(ctx)
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Stop stops checking the backends.
+func (h *Health) Stop() {
+	if h.cancel != nil {
+		h.cancel()
+	}
+}
+
+// Healthy reports whether the backend serving the app's variant passed its
+// last check.
+func (h *Health) Healthy(app config.App, variant string) bool {
+	if app.HealthPath == "" {
+		return true
+	}
+
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return !h.unhealthy[healthKey(canary.AppAddress(app, variant), app.HealthPath)]
+}
+
+// Check probes the stable and canary backends of every app with a health
+// path.
+func (h *Health) Check(ctx context.Context) {
+	for _, app := range h.Config.AllApps() {
+		if app.HealthPath == "" {
+			continue
+		}
+
+		for _, address := range []string{app.Address, app.CanaryAddress} {
+			if address == "" {
+				continue
+			}
+
+			key := healthKey(address, app.HealthPath)
+			err := h.probe(ctx, address, app.HealthPath)
+
+			h.mu.Lock()
+			if was := h.unhealthy[key]; was != (err != nil) {
+				if err != nil {
+					log.Printf("App %s at %s is unhealthy: %v", app.Alias, address, err)
+				} else {
+					log.Printf("App %s at %s is healthy again", app.Alias, address)
+				}
+			}
+			h.unhealthy[key] = err != nil
+			h.mu.Unlock()
+		}
+	}
+}
+
+func (h *Health) probe(ctx context.Context, address string, path string) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", fmt.Sprintf("%s://%s%s", h.Config.AppHealth.Scheme, address, path), nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 400 {
+		return fmt.Errorf("health check returned %d", resp.StatusCode)
+	}
+	return nil
+}
+
+func healthKey(address string, path string) string {
+	return address + path
+}
@@ -0,0 +1,145 @@
+// Copyright 2025 KDex Tech
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package canary
+
+import (
+	"hash/crc32"
+	"log"
+	"net/http"
+
+	"golang.org/x/exp/rand"
+	"kdex.dev/proxy/internal/config"
+	kctx "kdex.dev/proxy/internal/context"
+	"kdex.dev/proxy/internal/expression"
+	"kdex.dev/proxy/internal/store/session"
+)
+
+const (
+	Canary = "canary"
+	Stable = "stable"
+)
+
+// Router decides whether a request is served by the stable or the canary
+// variant of the upstream and of the apps.
+type Router struct {
+	Config            *config.CanaryConfig
+	Evaluator         *expression.Evaluator
+	SessionCookieName string
+	enabled           bool
+}
+
+func NewRouter(config *config.Config) *Router {
+	enabled := config.Proxy.Canary.Address != "" || config.DynamicApps()
+	for _, app := range config.Apps {
+		if app.CanaryAddress != "" {
+			enabled = true
+		}
+	}
+
+	return &Router{
+		Config:            &config.Proxy.Canary,
+		Evaluator:         expression.NewEvaluator(),
+		SessionCookieName: config.Session.CookieName,
+		enabled:           enabled,
+	}
+}
+
+// Select returns the variant for the request. In order of precedence the
+// variant comes from the override header, the expression over the session
+// claims, the sticky cookie, and finally the weight. Weighted choices are
+// derived from the session id when there is one, so they stay consistent for
+// the session; otherwise they are random and must be persisted in the sticky
+// cookie.
+func (r *Router) Select(req *http.Request) kctx.Variant {
+	if !r.enabled {
+		return kctx.Variant{Name: Stable}
+	}
+
+	if r.Config.Header != "" {
+		if v := req.Header.Get(r.Config.Header); v == Canary || v == Stable {
+			return kctx.Variant{Name: v}
+		}
+	}
+
+	if r.Config.Expression != "" {
+		sessionData, ok := req.Context().Value(kctx.SessionDataKey).(*session.SessionData)
+		if ok && sessionData != nil {
+			result, err := r.Evaluator.Evaluate(r.Config.Expression, sessionData.Data)
+			if err != nil {
+				log.Printf("failed to evaluate canary expression: %v", err)
+			} else if matched, ok := result.(bool); ok && matched {
+				return kctx.Variant{Name: Canary}
+			}
+		}
+	}
+
+	if cookie, err := req.Cookie(r.Config.CookieName); err == nil && (cookie.Value == Canary || cookie.Value == Stable) {
+		return kctx.Variant{Name: cookie.Value}
+	}
+
+	if r.Config.Weight <= 0 {
+		return kctx.Variant{Name: Stable}
+	}
+
+	if cookie, err := req.Cookie(r.SessionCookieName); err == nil && cookie.Value != "" {
+		bucket := float64(crc32.ChecksumIEEE([]byte(cookie.Value))%10000) / 100
+		return kctx.Variant{Name: variant(bucket < r.Config.Weight)}
+	}
+
+	return kctx.Variant{
+		Name:    variant(rand.Float64()*100 < r.Config.Weight),
+		Persist: true,
+	}
+}
+
+// Vary returns the request headers the variant is selected by.
+func (r *Router) Vary() []string {
+	if !r.enabled {
+		return nil
+	}
+
+	vary := []string{"Cookie"}
+	if r.Config.Header != "" {
+		vary = append(vary, r.Config.Header)
+	}
+	return vary
+}
+
+// Cookie returns the sticky cookie recording the variant.
+func (r *Router) Cookie(v kctx.Variant) *http.Cookie {
+	return &http.Cookie{
+		HttpOnly: true,
+		Name:     r.Config.CookieName,
+		Path:     "/",
+		SameSite: http.SameSiteLaxMode,
+		Value:    v.Name,
+	}
+}
+
+// AppAddress returns the address serving the app for the variant, falling
+// back to the stable address when the app has no canary.
+func AppAddress(app config.App, variant string) string {
+	if variant == Canary && app.CanaryAddress != "" {
+		return app.CanaryAddress
+	}
+	return app.Address
+}
+
+func variant(canary bool) string {
+	if canary {
+		return Canary
+	}
+	return Stable
+}
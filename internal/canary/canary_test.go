@@ -0,0 +1,111 @@
+// Copyright 2025 KDex Tech
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package canary
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"kdex.dev/proxy/internal/config"
+	kctx "kdex.dev/proxy/internal/context"
+	"kdex.dev/proxy/internal/store/session"
+)
+
+func TestRouter_Select(t *testing.T) {
+	tests := []struct {
+		name    string
+		canary  config.CanaryConfig
+		headers map[string]string
+		cookies []*http.Cookie
+		session *session.SessionData
+		want    kctx.Variant
+	}{
+		{
+			name:   "disabled",
+			canary: config.CanaryConfig{Weight: 100},
+			want:   kctx.Variant{Name: Stable},
+		},
+		{
+			name:    "header override",
+			canary:  config.CanaryConfig{Address: "canary", Header: "X-Canary", Weight: 100},
+			headers: map[string]string{"X-Canary": "stable"},
+			want:    kctx.Variant{Name: Stable},
+		},
+		{
+			name:   "expression over claims",
+			canary: config.CanaryConfig{Address: "canary", CookieName: "kdex_canary", Expression: `"beta" in data.groups`},
+			session: &session.SessionData{
+				Data: map[string]interface{}{"groups": []string{"beta"}},
+			},
+			want: kctx.Variant{Name: Canary},
+		},
+		{
+			name:   "expression not matching",
+			canary: config.CanaryConfig{Address: "canary", CookieName: "kdex_canary", Expression: `"beta" in data.groups`},
+			session: &session.SessionData{
+				Data: map[string]interface{}{"groups": []string{"staff"}},
+			},
+			want: kctx.Variant{Name: Stable},
+		},
+		{
+			name:    "sticky cookie",
+			canary:  config.CanaryConfig{Address: "canary", CookieName: "kdex_canary", Weight: 0},
+			cookies: []*http.Cookie{{Name: "kdex_canary", Value: "canary"}},
+			want:    kctx.Variant{Name: Canary},
+		},
+		{
+			name:    "weight derived from session",
+			canary:  config.CanaryConfig{Address: "canary", CookieName: "kdex_canary", Weight: 100},
+			cookies: []*http.Cookie{{Name: "session_id", Value: "abc"}},
+			want:    kctx.Variant{Name: Canary},
+		},
+		{
+			name:   "weight without session is persisted",
+			canary: config.CanaryConfig{Address: "canary", CookieName: "kdex_canary", Weight: 100},
+			want:   kctx.Variant{Name: Canary, Persist: true},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := *config.DefaultConfig()
+			c.Proxy.Canary = tt.canary
+			router := NewRouter(&c)
+
+			r := httptest.NewRequest("GET", "/", nil)
+			for k, v := range tt.headers {
+				r.Header.Set(k, v)
+			}
+			for _, cookie := range tt.cookies {
+				r.AddCookie(cookie)
+			}
+			if tt.session != nil {
+				r = r.WithContext(context.WithValue(r.Context(), kctx.SessionDataKey, tt.session))
+			}
+
+			assert.Equal(t, tt.want, router.Select(r))
+		})
+	}
+}
+
+func TestAppAddress(t *testing.T) {
+	app := config.App{Address: "app:80", CanaryAddress: "app-canary:80"}
+
+	assert.Equal(t, "app:80", AppAddress(app, Stable))
+	assert.Equal(t, "app-canary:80", AppAddress(app, Canary))
+	assert.Equal(t, "app:80", AppAddress(config.App{Address: "app:80"}, Canary))
+}
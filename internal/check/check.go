@@ -19,8 +19,10 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"hash/crc32"
 	"io"
 	"net/http"
+	"slices"
 	"strings"
 
 	"kdex.dev/proxy/internal/config"
@@ -112,6 +114,20 @@ func (c *Checker) Check(ctx context.Context, resource string, action string) (bo
 	return c.check(userRoles, resource, action)
 }
 
+// RolesKey identifies the results of the checks for the request: requests
+// with the same roles get the same results. It's empty without a permission
+// provider, when every check is denied alike.
+func (c *Checker) RolesKey(ctx context.Context) string {
+	if c == nil || c.PermissionProvider == nil {
+		return ""
+	}
+
+	userRoles, _ := ctx.Value(kctx.UserRolesKey).([]string)
+	roles := slices.Clone(userRoles)
+	slices.Sort(roles)
+	return fmt.Sprintf("roles-%x", crc32.ChecksumIEEE([]byte(strings.Join(roles, "\n"))))
+}
+
 func (c *Checker) CheckBatch(ctx context.Context, tuples []CheckBatchTuples) ([]CheckBatchResult, error) {
 	userRoles, ok := ctx.Value(kctx.UserRolesKey).([]string)
 	if !ok || len(userRoles) == 0 {
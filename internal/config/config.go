@@ -20,6 +20,10 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
 	"time"
 
 	"hash/crc32"
@@ -29,30 +33,72 @@ import (
 )
 
 type Config struct {
-	Apps          []App             `json:"apps,omitempty" yaml:"apps,omitempty"`
-	Authn         AuthnConfig       `json:"authn,omitempty" yaml:"authn,omitempty"`
-	Authz         AuthzConfig       `json:"authz,omitempty" yaml:"authz,omitempty"`
-	Expressions   ExpressionsConfig `json:"expressions,omitempty" yaml:"expressions,omitempty"`
-	Fileserver    FileserverConfig  `json:"fileserver,omitempty" yaml:"fileserver,omitempty"`
-	Importmap     ImportmapConfig   `json:"importmap,omitempty" yaml:"importmap,omitempty"`
-	ListenAddress string            `json:"listen_address,omitempty" yaml:"listen_address,omitempty"`
-	ListenPort    string            `json:"listen_port,omitempty" yaml:"listen_port,omitempty"`
-	ModuleDir     string            `json:"module_dir,omitempty" yaml:"module_dir,omitempty"`
-	Navigation    NavigationConfig  `json:"navigation,omitempty" yaml:"navigation,omitempty"`
-	Proxy         ProxyConfig       `json:"proxy" yaml:"proxy"`
-	Session       SessionConfig     `json:"session,omitempty" yaml:"session,omitempty"`
-	State         StateConfig       `json:"state,omitempty" yaml:"state,omitempty"`
+	AppAssets     AppAssetsConfig     `json:"app_assets,omitempty" yaml:"app_assets,omitempty"`
+	AppHealth     AppHealthConfig     `json:"app_health,omitempty" yaml:"app_health,omitempty"`
+	Apps          []App               `json:"apps,omitempty" yaml:"apps,omitempty"`
+	Authn         AuthnConfig         `json:"authn,omitempty" yaml:"authn,omitempty"`
+	Authz         AuthzConfig         `json:"authz,omitempty" yaml:"authz,omitempty"`
+	Discovery     DiscoveryConfig     `json:"discovery,omitempty" yaml:"discovery,omitempty"`
+	Expressions   ExpressionsConfig   `json:"expressions,omitempty" yaml:"expressions,omitempty"`
+	Fileserver    FileserverConfig    `json:"fileserver,omitempty" yaml:"fileserver,omitempty"`
+	Importmap     ImportmapConfig     `json:"importmap,omitempty" yaml:"importmap,omitempty"`
+	ListenAddress string              `json:"listen_address,omitempty" yaml:"listen_address,omitempty"`
+	ListenPort    string              `json:"listen_port,omitempty" yaml:"listen_port,omitempty"`
+	Locale        LocaleConfig        `json:"locale,omitempty" yaml:"locale,omitempty"`
+	ModuleDir     string              `json:"module_dir,omitempty" yaml:"module_dir,omitempty"`
+	Navigation    NavigationConfig    `json:"navigation,omitempty" yaml:"navigation,omitempty"`
+	Proxy         ProxyConfig         `json:"proxy" yaml:"proxy"`
+	Registry      RegistryConfig      `json:"registry,omitempty" yaml:"registry,omitempty"`
+	Rules         []Rule              `json:"rules,omitempty" yaml:"rules,omitempty"`
+	Session       SessionConfig       `json:"session,omitempty" yaml:"session,omitempty"`
+	State         StateConfig         `json:"state,omitempty" yaml:"state,omitempty"`
+	Templates     TemplatesConfig     `json:"templates,omitempty" yaml:"templates,omitempty"`
+	Transform     TransformConfig     `json:"transform,omitempty" yaml:"transform,omitempty"`
+	Transformers  []TransformerConfig `json:"transformers,omitempty" yaml:"transformers,omitempty"`
+	appProviders  []AppProvider
 	hash          uint32
 	json          bool
 }
 
+// AppProvider supplies apps in addition to the configured ones, such as apps
+// registered at runtime. Providers are added before the proxy serves.
+type AppProvider interface {
+	Apps() []App
+}
+
 type App struct {
-	Alias          string   `json:"alias,omitempty" yaml:"alias,omitempty"`
-	Address        string   `json:"address" yaml:"address"`
-	Element        string   `json:"element" yaml:"element"`
-	Path           string   `json:"path" yaml:"path"`
-	Targets        []Target `json:"targets" yaml:"targets"`
-	RequiredScopes []string `json:"required_scopes,omitempty" yaml:"required_scopes,omitempty"`
+	Alias                string                 `json:"alias,omitempty" yaml:"alias,omitempty"`
+	Address              string                 `json:"address" yaml:"address"`
+	AttributeExpressions map[string]string      `json:"attribute_expressions,omitempty" yaml:"attribute_expressions,omitempty"` // CEL over data and request, by attribute name
+	Attributes           map[string]string      `json:"attributes,omitempty" yaml:"attributes,omitempty"`
+	CanaryAddress        string                 `json:"canary_address,omitempty" yaml:"canary_address,omitempty"`
+	Config               map[string]interface{} `json:"config,omitempty" yaml:"config,omitempty"`                       // Rendered as JSON into data-config
+	ConfigExpression     string                 `json:"config_expression,omitempty" yaml:"config_expression,omitempty"` // CEL map merged over Config
+	Element              string                 `json:"element" yaml:"element"`
+	Fallback             string                 `json:"fallback,omitempty" yaml:"fallback,omitempty"`       // Markup rendered in place of the app while it is unhealthy
+	HealthPath           string                 `json:"health_path,omitempty" yaml:"health_path,omitempty"` // Checked on the app address; no checks when empty
+	ModuleDir            string                 `json:"module_dir,omitempty" yaml:"module_dir,omitempty"`   // Directory under module_dir with the app's own dependencies, imported through an importmap scope
+	Path                 string                 `json:"path" yaml:"path"`
+	Placeholder          string                 `json:"placeholder,omitempty" yaml:"placeholder,omitempty"` // Markup rendered in place of the app for users who may not use it
+	Targets              []Target               `json:"targets" yaml:"targets"`
+	RequiredScopes       []string               `json:"required_scopes,omitempty" yaml:"required_scopes,omitempty"`
+	Skeleton             string                 `json:"skeleton,omitempty" yaml:"skeleton,omitempty"` // Markup shown inside the element until it upgrades
+}
+
+type AppHealthConfig struct {
+	Interval time.Duration `json:"interval,omitempty" yaml:"interval,omitempty"`
+	Scheme   string        `json:"scheme,omitempty" yaml:"scheme,omitempty"`
+	Timeout  time.Duration `json:"timeout,omitempty" yaml:"timeout,omitempty"`
+}
+
+type AppAssetsConfig struct {
+	Cache              CacheConfig   `json:"cache,omitempty" yaml:"cache,omitempty"`
+	CacheControl       string        `json:"cache_control,omitempty" yaml:"cache_control,omitempty"` // Sent when the app backend sends none, private for restricted apps
+	Enabled            bool          `json:"enabled,omitempty" yaml:"enabled,omitempty"`             // Serve app assets same-origin under Prefix
+	ForwardCredentials bool          `json:"forward_credentials,omitempty" yaml:"forward_credentials,omitempty"`
+	Prefix             string        `json:"prefix,omitempty" yaml:"prefix,omitempty"`
+	Scheme             string        `json:"scheme,omitempty" yaml:"scheme,omitempty"` // Scheme of the app backends
+	Timeout            time.Duration `json:"timeout,omitempty" yaml:"timeout,omitempty"`
 }
 
 type AuthnConfig struct {
@@ -70,6 +116,7 @@ type AuthnConfig struct {
 type AuthzConfig struct {
 	Endpoints AuthzEndpoints            `json:"endpoints,omitempty" yaml:"endpoints,omitempty"`
 	Provider  string                    `json:"provider" yaml:"provider"`
+	Prune     PruneConfig               `json:"prune,omitempty" yaml:"prune,omitempty"`
 	Static    StaticAuthzProviderConfig `json:"static,omitempty" yaml:"static,omitempty"`
 }
 
@@ -88,17 +135,70 @@ type CacheConfig struct {
 	TTL  time.Duration `json:"ttl" yaml:"ttl"`
 }
 
+type CanaryConfig struct {
+	Address    string  `json:"address,omitempty" yaml:"address,omitempty"`
+	CookieName string  `json:"cookie_name,omitempty" yaml:"cookie_name,omitempty"`
+	Expression string  `json:"expression,omitempty" yaml:"expression,omitempty"`
+	Header     string  `json:"header,omitempty" yaml:"header,omitempty"`
+	Weight     float64 `json:"weight,omitempty" yaml:"weight,omitempty"`
+}
+
+type DiscoveryConfig struct {
+	Enabled       bool          `json:"enabled,omitempty" yaml:"enabled,omitempty"`               // Build apps from annotated Kubernetes Services
+	Kubeconfig    string        `json:"kubeconfig,omitempty" yaml:"kubeconfig,omitempty"`         // Used outside the cluster; the in-cluster config otherwise
+	LabelSelector string        `json:"label_selector,omitempty" yaml:"label_selector,omitempty"` // Selects the Services describing apps
+	Namespace     string        `json:"namespace,omitempty" yaml:"namespace,omitempty"`           // Watched namespace; Namespace or Namespaces is required
+	Namespaces    []string      `json:"namespaces,omitempty" yaml:"namespaces,omitempty"`         // Watched namespaces, in addition to Namespace
+	Resync        time.Duration `json:"resync,omitempty" yaml:"resync,omitempty"`
+}
+
 type ExpressionsConfig struct {
 	Roles     string `json:"roles,omitempty" yaml:"roles,omitempty"`
 	Principal string `json:"principal,omitempty" yaml:"principal,omitempty"`
+	Scopes    string `json:"scopes,omitempty" yaml:"scopes,omitempty"` // A list or a space separated string of the granted scopes
 }
 
 type FileserverConfig struct {
 	Prefix string `json:"prefix,omitempty" yaml:"prefix,omitempty"`
 }
 
+type HeaderActions struct {
+	Add    map[string]string `json:"add,omitempty" yaml:"add,omitempty"`
+	Remove []string          `json:"remove,omitempty" yaml:"remove,omitempty"`
+	Set    map[string]string `json:"set,omitempty" yaml:"set,omitempty"`
+}
+
+type HeaderRule struct {
+	Methods  []string      `json:"methods,omitempty" yaml:"methods,omitempty"`
+	Paths    []string      `json:"paths,omitempty" yaml:"paths,omitempty"`
+	Request  HeaderActions `json:"request,omitempty" yaml:"request,omitempty"`
+	Response HeaderActions `json:"response,omitempty" yaml:"response,omitempty"`
+}
+
+type HeadersConfig struct {
+	// Cache-Control value forced onto transformed HTML responses; empty keeps
+	// the upstream value.
+	HTMLCacheControl string       `json:"html_cache_control" yaml:"html_cache_control"`
+	Rules            []HeaderRule `json:"rules,omitempty" yaml:"rules,omitempty"`
+}
+
 type ImportmapConfig struct {
-	PreloadModules []string `json:"preload_modules,omitempty" yaml:"preload_modules,omitempty"`
+	Integrity      IntegrityConfig `json:"integrity,omitempty" yaml:"integrity,omitempty"`
+	PreloadModules []string        `json:"preload_modules,omitempty" yaml:"preload_modules,omitempty"`
+}
+
+type IntegrityConfig struct {
+	Enabled bool          `json:"enabled,omitempty" yaml:"enabled,omitempty"` // Add SHA-384 subresource integrity for modules in module_dir
+	Refresh time.Duration `json:"refresh,omitempty" yaml:"refresh,omitempty"` // How often modules are scanned for changes
+}
+
+type LocaleConfig struct {
+	CatalogDir string                       `json:"catalog_dir,omitempty" yaml:"catalog_dir,omitempty"` // Directory of <locale>.yaml or <locale>.json catalogs
+	Catalogs   map[string]map[string]string `json:"catalogs,omitempty" yaml:"catalogs,omitempty"`       // Messages by locale, keyed by the default locale's text
+	CookieName string                       `json:"cookie_name,omitempty" yaml:"cookie_name,omitempty"`
+	Default    string                       `json:"default,omitempty" yaml:"default,omitempty"`
+	PathPrefix bool                         `json:"path_prefix,omitempty" yaml:"path_prefix,omitempty"` // Negotiate from a leading /<locale>/ path segment
+	Supported  []string                     `json:"supported,omitempty" yaml:"supported,omitempty"`
 }
 
 type LoginConfig struct {
@@ -113,12 +213,34 @@ type LogoutConfig struct {
 	Query string `json:"query" yaml:"query"`
 }
 
+type MirrorConfig struct {
+	Address            string        `json:"address,omitempty" yaml:"address,omitempty"`
+	ForwardCredentials bool          `json:"forward_credentials,omitempty" yaml:"forward_credentials,omitempty"`
+	MaxConcurrency     int           `json:"max_concurrency,omitempty" yaml:"max_concurrency,omitempty"`
+	Methods            []string      `json:"methods,omitempty" yaml:"methods,omitempty"`
+	Percentage         float64       `json:"percentage,omitempty" yaml:"percentage,omitempty"`
+	Scheme             string        `json:"scheme,omitempty" yaml:"scheme,omitempty"`
+	Timeout            time.Duration `json:"timeout,omitempty" yaml:"timeout,omitempty"`
+}
+
 type NavigationConfig struct {
-	NavItemsQuery   string            `json:"nav_items_query" yaml:"nav_items_query"`
-	NavItemFields   map[string]string `json:"nav_item_fields" yaml:"nav_item_fields"`
-	NavItemTemplate string            `json:"nav_item_template" yaml:"nav_item_template"`
-	ProtectedPaths  []string          `json:"protected_paths" yaml:"protected_paths"`
-	TemplatePaths   []TemplatePath    `json:"template_paths" yaml:"template_paths"`
+	BreadcrumbsQuery    string            `json:"breadcrumbs_query,omitempty" yaml:"breadcrumbs_query,omitempty"`       // XPath of the element the breadcrumbs are rendered into
+	BreadcrumbsTemplate string            `json:"breadcrumbs_template,omitempty" yaml:"breadcrumbs_template,omitempty"` // Rendered with .breadcrumbs, .params and .path
+	ContainerQuery      string            `json:"container_query,omitempty" yaml:"container_query,omitempty"`           // XPath of the placeholder rendered into when no items are scraped
+	NavItemsQuery       string            `json:"nav_items_query" yaml:"nav_items_query"`
+	NavItemFields       map[string]string `json:"nav_item_fields" yaml:"nav_item_fields"`
+	NavItemTemplate     string            `json:"nav_item_template" yaml:"nav_item_template"`
+	NavTemplate         string            `json:"nav_template,omitempty" yaml:"nav_template,omitempty"` // Renders the whole tree; replaces NavItemTemplate when set
+	ProtectedPaths      []string          `json:"protected_paths" yaml:"protected_paths"`
+	Source              NavigationSource  `json:"source,omitempty" yaml:"source,omitempty"`
+	TemplatePaths       []TemplatePath    `json:"template_paths" yaml:"template_paths"`
+}
+
+type NavigationSource struct {
+	File    string        `json:"file,omitempty" yaml:"file,omitempty"`       // YAML or JSON file of nav items
+	Refresh time.Duration `json:"refresh,omitempty" yaml:"refresh,omitempty"` // How long loaded items are reused
+	Timeout time.Duration `json:"timeout,omitempty" yaml:"timeout,omitempty"`
+	URL     string        `json:"url,omitempty" yaml:"url,omitempty"` // Endpoint serving nav items as YAML or JSON
 }
 
 type OAuthConfig struct {
@@ -138,17 +260,61 @@ type Permission struct {
 	Resource  string `json:"resource" yaml:"resource"`   // Resource being accessed (e.g., "page", "api")
 }
 
+type PermissionCheck struct {
+	Action   string `json:"action" yaml:"action"`
+	Resource string `json:"resource" yaml:"resource"`
+}
+
 type ProxyConfig struct {
-	AlwaysAppendSlash   bool        `json:"always_append_slash,omitempty" yaml:"always_append_slash,omitempty"`
-	AppendIndex         bool        `json:"append_index,omitempty" yaml:"append_index,omitempty"`
-	Cache               CacheConfig `json:"cache,omitempty" yaml:"cache,omitempty"`
-	IndexFile           string      `json:"index_file,omitempty" yaml:"index_file,omitempty"`
-	PathSeparator       string      `json:"path_separator,omitempty" yaml:"path_separator,omitempty"`
-	ProbePath           string      `json:"probe_path,omitempty" yaml:"probe_path,omitempty"`
-	UpstreamAddress     string      `json:"upstream_address" yaml:"upstream_address"`
-	UpstreamPrefix      string      `json:"upstream_prefix,omitempty" yaml:"upstream_prefix,omitempty"`
-	UpstreamScheme      string      `json:"upstream_scheme,omitempty" yaml:"upstream_scheme,omitempty"`
-	UpstreamHealthzPath string      `json:"upstream_healthz_path,omitempty" yaml:"upstream_healthz_path,omitempty"`
+	AlwaysAppendSlash   bool          `json:"always_append_slash,omitempty" yaml:"always_append_slash,omitempty"`
+	AppendIndex         bool          `json:"append_index,omitempty" yaml:"append_index,omitempty"`
+	Cache               CacheConfig   `json:"cache,omitempty" yaml:"cache,omitempty"`
+	Canary              CanaryConfig  `json:"canary,omitempty" yaml:"canary,omitempty"`
+	Headers             HeadersConfig `json:"headers,omitempty" yaml:"headers,omitempty"`
+	IndexFile           string        `json:"index_file,omitempty" yaml:"index_file,omitempty"`
+	Mirror              MirrorConfig  `json:"mirror,omitempty" yaml:"mirror,omitempty"`
+	PathSeparator       string        `json:"path_separator,omitempty" yaml:"path_separator,omitempty"`
+	ProbePath           string        `json:"probe_path,omitempty" yaml:"probe_path,omitempty"`
+	Rewrite             RewriteConfig `json:"rewrite,omitempty" yaml:"rewrite,omitempty"`
+	UpstreamAddress     string        `json:"upstream_address" yaml:"upstream_address"`
+	UpstreamPrefix      string        `json:"upstream_prefix,omitempty" yaml:"upstream_prefix,omitempty"`
+	UpstreamScheme      string        `json:"upstream_scheme,omitempty" yaml:"upstream_scheme,omitempty"`
+	UpstreamHealthzPath string        `json:"upstream_healthz_path,omitempty" yaml:"upstream_healthz_path,omitempty"`
+}
+
+type PruneConfig struct {
+	ActionAttribute   string `json:"action_attribute,omitempty" yaml:"action_attribute,omitempty"`
+	DefaultAction     string `json:"default_action,omitempty" yaml:"default_action,omitempty"` // Used when an element has no action attribute
+	MarkAttribute     string `json:"mark_attribute,omitempty" yaml:"mark_attribute,omitempty"`
+	Mode              string `json:"mode,omitempty" yaml:"mode,omitempty"` // "remove" or "mark"
+	ResourceAttribute string `json:"resource_attribute,omitempty" yaml:"resource_attribute,omitempty"`
+}
+
+type RegistryConfig struct {
+	Enabled  bool          `json:"enabled,omitempty" yaml:"enabled,omitempty"`   // Serve the app registry API
+	Endpoint string        `json:"endpoint,omitempty" yaml:"endpoint,omitempty"` // Base path of the registry API
+	File     string        `json:"file,omitempty" yaml:"file,omitempty"`         // JSON file of the file store
+	Refresh  time.Duration `json:"refresh,omitempty" yaml:"refresh,omitempty"`   // How long stored apps are reused; 0 reloads only on changes
+	Store    string        `json:"store,omitempty" yaml:"store,omitempty"`       // memory or file
+}
+
+type RewriteConfig struct {
+	Attributes    []string `json:"attributes,omitempty" yaml:"attributes,omitempty"`
+	Cookies       bool     `json:"cookies,omitempty" yaml:"cookies,omitempty"`
+	Enabled       bool     `json:"enabled,omitempty" yaml:"enabled,omitempty"`
+	Headers       []string `json:"headers,omitempty" yaml:"headers,omitempty"`
+	UpstreamHosts []string `json:"upstream_hosts,omitempty" yaml:"upstream_hosts,omitempty"`
+}
+
+type Rule struct {
+	Action    string   `json:"action" yaml:"action"`                           // e.g. "append", "remove", "set_attribute"
+	Attribute string   `json:"attribute,omitempty" yaml:"attribute,omitempty"` // Attribute for set_attribute and remove_attribute
+	Condition string   `json:"condition,omitempty" yaml:"condition,omitempty"` // CEL expression over data and request
+	Fragment  string   `json:"fragment,omitempty" yaml:"fragment,omitempty"`   // HTML for the insert and replace actions
+	Paths     []string `json:"paths,omitempty" yaml:"paths,omitempty"`
+	Selector  string   `json:"selector,omitempty" yaml:"selector,omitempty"` // CSS selector
+	Value     string   `json:"value,omitempty" yaml:"value,omitempty"`       // Attribute value, class or text
+	XPath     string   `json:"xpath,omitempty" yaml:"xpath,omitempty"`
 }
 
 type SessionConfig struct {
@@ -156,10 +322,21 @@ type SessionConfig struct {
 	Store      string `json:"store,omitempty" yaml:"store,omitempty"`
 }
 
+type StateBootstrapConfig struct {
+	Claims      []string          `json:"claims,omitempty" yaml:"claims,omitempty"`         // Claims embedded in data; none when empty
+	ElementID   string            `json:"element_id,omitempty" yaml:"element_id,omitempty"` // Id of the JSON script element
+	Permissions []PermissionCheck `json:"permissions,omitempty" yaml:"permissions,omitempty"`
+}
+
 type StateConfig struct {
-	Endpoint string        `json:"endpoint,omitempty" yaml:"endpoint,omitempty"`
-	TTL      time.Duration `json:"ttl,omitempty" yaml:"ttl,omitempty"`
-	Type     string        `json:"type,omitempty" yaml:"type,omitempty"`
+	Bootstrap   StateBootstrapConfig `json:"bootstrap,omitempty" yaml:"bootstrap,omitempty"`
+	Claims      []string             `json:"claims,omitempty" yaml:"claims,omitempty"` // Claim paths exposed in data, e.g. "address.country"; all claims when empty
+	Endpoint    string               `json:"endpoint,omitempty" yaml:"endpoint,omitempty"`
+	Expression  string               `json:"expression,omitempty" yaml:"expression,omitempty"` // CEL producing the data object; overrides Claims
+	Fields      map[string]string    `json:"fields,omitempty" yaml:"fields,omitempty"`         // Derived fields added to data, as CEL expressions
+	Permissions []PermissionCheck    `json:"permissions,omitempty" yaml:"permissions,omitempty"`
+	TTL         time.Duration        `json:"ttl,omitempty" yaml:"ttl,omitempty"`
+	Type        string               `json:"type,omitempty" yaml:"type,omitempty"`
 }
 
 type StaticAuthzProviderConfig struct {
@@ -167,22 +344,55 @@ type StaticAuthzProviderConfig struct {
 }
 
 type Target struct {
-	Path      string `json:"path" yaml:"path"`
-	Container string `json:"container_id,omitempty" yaml:"container_id,omitempty"`
+	Path        string `json:"path" yaml:"path"`
+	Container   string `json:"container_id,omitempty" yaml:"container_id,omitempty"`
+	Order       int    `json:"order,omitempty" yaml:"order,omitempty"`               // Apps sharing a container are placed by ascending order
+	ParentQuery string `json:"parent_query,omitempty" yaml:"parent_query,omitempty"` // XPath of the element the container is created in when the page has none
+	Position    string `json:"position,omitempty" yaml:"position,omitempty"`         // replace (default), append or prepend to the container's content
 }
 
 type TemplatePath struct {
-	Href     string  `json:"href" yaml:"href"`
+	Href     string  `json:"href" yaml:"href"` // Prefix of the routed paths; segments such as {id} capture parameters
 	Label    string  `json:"label" yaml:"label"`
-	Template string  `json:"template" yaml:"template"`
+	Parent   string  `json:"parent,omitempty" yaml:"parent,omitempty"` // Href of the parent item; defaults to the nearest enclosing path
+	Template string  `json:"template" yaml:"template"`                 // Upstream page; may use the captured parameters
 	Weight   float64 `json:"weight" yaml:"weight"`
 }
 
+type TemplatesConfig struct {
+	Files []string `json:"files,omitempty" yaml:"files,omitempty"` // Glob patterns of files defining named templates and partials
+}
+
+type TransformConfig struct {
+	OnError string        `json:"on_error,omitempty" yaml:"on_error,omitempty"` // "fail", "skip" or "original"
+	Timeout time.Duration `json:"timeout,omitempty" yaml:"timeout,omitempty"`   // Budget for all transformers of a request
+}
+
+type TransformerConfig struct {
+	Disabled     bool     `json:"disabled,omitempty" yaml:"disabled,omitempty"`
+	ExcludePaths []string `json:"exclude_paths,omitempty" yaml:"exclude_paths,omitempty"`
+	Markers      []string `json:"markers,omitempty" yaml:"markers,omitempty"` // CSS selectors of which at least one must match
+	Name         string   `json:"name" yaml:"name"`
+	OnError      string   `json:"on_error,omitempty" yaml:"on_error,omitempty"` // Overrides TransformConfig.OnError
+	Paths        []string `json:"paths,omitempty" yaml:"paths,omitempty"`
+}
+
 type RolesConfig struct {
 	Expression string `json:"expression" yaml:"expression"`
 }
 
 var defaultConfig = Config{
+	AppAssets: AppAssetsConfig{
+		CacheControl: "private, max-age=300",
+		Prefix:       "/~/apps/",
+		Scheme:       "http",
+		Timeout:      30 * time.Second,
+	},
+	AppHealth: AppHealthConfig{
+		Interval: 30 * time.Second,
+		Scheme:   "http",
+		Timeout:  5 * time.Second,
+	},
 	Authn: AuthnConfig{
 		AuthenticateHeader:     "WWW-Authenticate",
 		AuthorizationHeader:    "Authorization",
@@ -213,28 +423,52 @@ var defaultConfig = Config{
 			Batch:  "/~/check/batch",
 		},
 		Provider: "static",
+		Prune: PruneConfig{
+			ActionAttribute:   "data-kdex-action",
+			DefaultAction:     "read",
+			MarkAttribute:     "data-kdex-denied",
+			Mode:              "remove",
+			ResourceAttribute: "data-kdex-resource",
+		},
+	},
+	Discovery: DiscoveryConfig{
+		LabelSelector: "kdex.dev/app=true",
+		Resync:        10 * time.Minute,
 	},
 	Expressions: ExpressionsConfig{
 		Principal: "data.preferred_username",
 		Roles:     "data.roles",
+		Scopes:    `has(data.scope) ? data.scope : ""`,
 	},
 	Fileserver: FileserverConfig{
 		Prefix: "/~/m/",
 	},
 	Importmap: ImportmapConfig{
+		Integrity: IntegrityConfig{
+			Refresh: 30 * time.Second,
+		},
 		PreloadModules: []string{
 			"@kdex/ui",
 		},
 	},
 	ListenAddress: "",
 	ListenPort:    "8080",
-	ModuleDir:     "/modules",
+	Locale: LocaleConfig{
+		CookieName: "kdex_locale",
+		Default:    "en",
+		Supported:  []string{"en"},
+	},
+	ModuleDir: "/modules",
 	Navigation: NavigationConfig{
 		NavItemsQuery:   `nav`,
 		NavItemFields:   map[string]string{},
 		NavItemTemplate: ``,
 		ProtectedPaths:  []string{},
-		TemplatePaths:   []TemplatePath{},
+		Source: NavigationSource{
+			Refresh: time.Minute,
+			Timeout: time.Second * 5,
+		},
+		TemplatePaths: []TemplatePath{},
 	},
 	Proxy: ProxyConfig{
 		AlwaysAppendSlash: false,
@@ -243,21 +477,59 @@ var defaultConfig = Config{
 			Type: "memory",
 			TTL:  time.Minute * 20,
 		},
-		IndexFile:           "index.html",
-		PathSeparator:       "/_/",
-		ProbePath:           "/~/probe",
+		Canary: CanaryConfig{
+			CookieName: "kdex_canary",
+		},
+		Headers: HeadersConfig{
+			HTMLCacheControl: "no-cache",
+		},
+		IndexFile: "index.html",
+		Mirror: MirrorConfig{
+			MaxConcurrency: 10,
+			Methods:        []string{"GET"},
+			Scheme:         "http",
+			Timeout:        time.Second * 10,
+		},
+		PathSeparator: "/_/",
+		ProbePath:     "/~/probe",
+		Rewrite: RewriteConfig{
+			Attributes: []string{"href", "src", "action", "srcset"},
+			Cookies:    true,
+			Enabled:    true,
+			Headers:    []string{"Location", "Content-Location", "Refresh"},
+		},
 		UpstreamScheme:      "http",
 		UpstreamHealthzPath: "/",
 	},
+	Registry: RegistryConfig{
+		Endpoint: "/~/registry/apps",
+		Store:    "memory",
+	},
 	Session: SessionConfig{
 		CookieName: "session_id",
 		Store:      "memory",
 	},
 	State: StateConfig{
+		Bootstrap: StateBootstrapConfig{
+			ElementID: "kdex-state",
+		},
 		Endpoint: "/~/state",
 		TTL:      time.Minute * 2,
 		Type:     "memory",
 	},
+	Transform: TransformConfig{
+		OnError: "fail",
+	},
+	Transformers: []TransformerConfig{
+		{Name: "rewrite"},
+		{Name: "importmap"},
+		{Name: "meta"},
+		{Name: "navigation"},
+		{Name: "app"},
+		{Name: "rules"},
+		{Name: "prune"},
+		{Name: "state", Disabled: true},
+	},
 }
 
 func DefaultConfig() *Config {
@@ -308,6 +580,31 @@ func NewConfigFromEnv() *Config {
 	return &config
 }
 
+const (
+	PositionAppend  = "append"
+	PositionPrepend = "prepend"
+	PositionReplace = "replace"
+)
+
+var (
+	// Aliases are URL path segments and element ids; @ separates the variant
+	// in asset paths.
+	aliasPattern          = regexp.MustCompile(`^[a-zA-Z0-9][-a-zA-Z0-9_.]*$`)
+	attributeNamePattern  = regexp.MustCompile(`^[a-zA-Z_:][-a-zA-Z0-9_:.]*$`)
+	reservedAppAttributes = []string{"data-config", "id", "locale", "route-params", "route-path"}
+	// Attributes that run script or load content, which config and registry
+	// entries must not be able to set from request or claims data.
+	unsafeAppAttributes = []string{"action", "formaction", "href", "is", "src", "srcdoc", "style", "xlink:href"}
+)
+
+// ValidateAlias reports whether the alias may identify an app.
+func ValidateAlias(alias string) error {
+	if !aliasPattern.MatchString(alias) {
+		return fmt.Errorf("app alias %q must be letters, digits, -, _ and . only", alias)
+	}
+	return nil
+}
+
 func (a *App) Validate() error {
 	if a.Address == "" {
 		return fmt.Errorf("app address is required")
@@ -325,20 +622,73 @@ func (a *App) Validate() error {
 		if target.Path == "" {
 			return fmt.Errorf("app targets page is required")
 		}
+		if !slices.Contains([]string{"", PositionAppend, PositionPrepend, PositionReplace}, target.Position) {
+			return fmt.Errorf("app target position %q is not one of append, prepend or replace", target.Position)
+		}
+	}
+	if a.HealthPath != "" && !strings.HasPrefix(a.HealthPath, "/") {
+		return fmt.Errorf("app health path must start with /")
+	}
+	if a.ModuleDir != "" && !filepath.IsLocal(a.ModuleDir) {
+		return fmt.Errorf("app module dir must be a relative path within the module dir")
+	}
+	for _, names := range [][]string{util.Keys(a.Attributes), util.Keys(a.AttributeExpressions)} {
+		for _, name := range names {
+			if !attributeNamePattern.MatchString(name) {
+				return fmt.Errorf("app attribute %q is not a valid attribute name", name)
+			}
+			if slices.Contains(reservedAppAttributes, strings.ToLower(name)) {
+				return fmt.Errorf("app attribute %q is reserved", name)
+			}
+			if strings.HasPrefix(strings.ToLower(name), "on") || slices.Contains(unsafeAppAttributes, strings.ToLower(name)) {
+				return fmt.Errorf("app attribute %q is not allowed", name)
+			}
+		}
 	}
 
 	if a.Alias == "" {
 		a.Alias = util.RandStringBytes(4)
 	}
+	if err := ValidateAlias(a.Alias); err != nil {
+		return err
+	}
 
 	return nil
 }
 
+// AddAppProvider adds a source of apps.
+func (c *Config) AddAppProvider(provider AppProvider) {
+	c.appProviders = append(c.appProviders, provider)
+}
+
+// DynamicApps reports whether apps may be added while the proxy runs.
+func (c *Config) DynamicApps() bool {
+	return c.Registry.Enabled || c.Discovery.Enabled
+}
+
+// AllApps returns the configured apps followed by the provided ones. The
+// configured apps take precedence over provided apps with the same alias.
+func (c *Config) AllApps() []App {
+	if len(c.appProviders) == 0 {
+		return c.Apps
+	}
+
+	apps := slices.Clone(c.Apps)
+	for _, provider := range c.appProviders {
+		for _, app := range provider.Apps() {
+			if !slices.ContainsFunc(apps, func(a App) bool { return a.Alias == app.Alias }) {
+				apps = append(apps, app)
+			}
+		}
+	}
+	return apps
+}
+
 func (c *Config) GetAppsForTargetPath(targetPath string) []App {
 	var filteredApps []App
-	for _, app := range c.Apps {
+	for _, app := range c.AllApps() {
 		for _, appTarget := range app.Targets {
-			if appTarget.Path == targetPath {
+			if appTarget.Matches(targetPath) {
 				filteredApps = append(filteredApps, app)
 			}
 		}
@@ -346,6 +696,25 @@ func (c *Config) GetAppsForTargetPath(targetPath string) []App {
 	return filteredApps
 }
 
+// Matches reports whether the target applies to the page. Targets with route
+// parameters match pages of any parameter values.
+func (t Target) Matches(path string) bool {
+	if !util.IsRoutePattern(t.Path) {
+		return t.Path == path
+	}
+	_, rest, ok := util.MatchRoute(t.Path, path)
+	return ok && rest == ""
+}
+
+func (c *Config) GetAppByAlias(alias string) (App, bool) {
+	for _, app := range c.AllApps() {
+		if app.Alias == alias {
+			return app, true
+		}
+	}
+	return App{}, false
+}
+
 func (c *Config) prettyPrint() {
 	var s []byte
 	if c.json {
@@ -356,14 +725,23 @@ func (c *Config) prettyPrint() {
 	log.Printf("Using config:\n%s", string(s))
 }
 
+// Hash identifies the config, including the provided apps.
 func (c *Config) Hash() uint32 {
-	if c.hash != 0 {
+	if c.hash == 0 {
+		configBytes, err := json.Marshal(c)
+		if err != nil {
+			return 0
+		}
+		c.hash = crc32.ChecksumIEEE(configBytes)
+	}
+
+	if len(c.appProviders) == 0 {
 		return c.hash
 	}
-	configBytes, err := json.Marshal(c)
+
+	appsBytes, err := json.Marshal(c.AllApps())
 	if err != nil {
-		return 0
+		return c.hash
 	}
-	c.hash = crc32.ChecksumIEEE(configBytes)
-	return c.hash
+	return crc32.Update(c.hash, crc32.IEEETable, appsBytes)
 }
@@ -14,17 +14,50 @@
 
 package context
 
+import "sync"
+
 type ContextKey string
 
 const (
+	LocaleKey       ContextKey = "locale"
+	MemoKey         ContextKey = "memo"
 	ProxiedEtagKey  ContextKey = "proxiedEtag"
 	ProxiedPartsKey ContextKey = "proxiedParts"
+	PublicOriginKey ContextKey = "publicOrigin"
+	RequestPathKey  ContextKey = "requestPath"
+	RouteParamsKey  ContextKey = "routeParams"
 	SessionDataKey  ContextKey = "sessionData"
 	UserRolesKey    ContextKey = "userRoles"
+	VariantKey      ContextKey = "variant"
 )
 
+// Memo holds values computed once per request, so a transformer's variant
+// key and its output can come from the same evaluation.
+type Memo struct {
+	values sync.Map
+}
+
+// Once returns the value stored under key, computing it on first use.
+func (m *Memo) Once(key any, compute func() any) any {
+	if value, ok := m.values.Load(key); ok {
+		return value
+	}
+	value, _ := m.values.LoadOrStore(key, compute())
+	return value
+}
+
 type ProxiedParts struct {
 	AppAlias    string
 	AppPath     string
 	ProxiedPath string
 }
+
+type PublicOrigin struct {
+	Host   string
+	Scheme string
+}
+
+type Variant struct {
+	Name    string
+	Persist bool
+}
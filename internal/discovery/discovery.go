@@ -0,0 +1,265 @@
+// Copyright 2025 KDex Tech
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package discovery
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+	"sync"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/clientcmd"
+	"kdex.dev/proxy/internal/config"
+)
+
+// Annotations read from a Service to describe the app it serves.
+const (
+	AnnotationAlias      = "kdex.dev/alias"       // Defaults to the Service name
+	AnnotationContainer  = "kdex.dev/container"   // Container id used for every target
+	AnnotationElement    = "kdex.dev/element"     // Required
+	AnnotationHealthPath = "kdex.dev/health-path" // Checked on the app address
+	AnnotationPath       = "kdex.dev/path"        // Required; path of the app script
+	AnnotationPort       = "kdex.dev/port"        // Defaults to the first Service port
+	AnnotationTarget     = "kdex.dev/target"      // Required; comma separated page paths
+)
+
+// Discovery watches Kubernetes Services and provides an app for each Service
+// annotated with at least an element, a path and a target. Services are
+// selected by the configured namespaces and label selector.
+//
+// Whoever may annotate a Service in a watched namespace decides which scripts
+// pages load, so only namespaces trusted as much as the proxy configuration
+// should be watched. Discovered apps can't take over the element of a
+// configured app.
+type Discovery struct {
+	Config    *config.Config
+	apps      map[string]config.App
+	cancel    context.CancelFunc
+	factories []informers.SharedInformerFactory
+	mu        sync.RWMutex
+}
+
+// NewDiscovery returns nil unless discovery is enabled. The discovery adds
+// itself to the config's app providers.
+func NewDiscovery(config *config.Config) *Discovery {
+	if !config.Discovery.Enabled {
+		return nil
+	}
+
+	if len(Namespaces(config)) == 0 {
+		log.Fatalf("Invalid discovery: a namespace or namespaces are required")
+	}
+
+	restConfig, err := restConfig(config.Discovery.Kubeconfig)
+	if err != nil {
+		log.Fatalf("Invalid discovery kubeconfig: %v", err)
+	}
+
+	client, err := kubernetes.NewForConfig(restConfig)
+	if err != nil {
+		log.Fatalf("Error creating discovery client: %v", err)
+	}
+
+	return newDiscovery(config, client)
+}
+
+func newDiscovery(c *config.Config, client kubernetes.Interface) *Discovery {
+	d := &Discovery{
+		Config: c,
+		apps:   map[string]config.App{},
+	}
+
+	for _, namespace := range Namespaces(c) {
+		factory := informers.NewSharedInformerFactoryWithOptions(
+			client,
+			c.Discovery.Resync,
+			informers.WithNamespace(namespace),
+			informers.WithTweakListOptions(func(options *metav1.ListOptions) {
+				options.LabelSelector = c.Discovery.LabelSelector
+			}),
+		)
+
+		_, err := factory.Core().V1().Services().Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+			AddFunc:    d.set,
+			UpdateFunc: func(_, obj interface{}) { d.set(obj) },
+			DeleteFunc: d.delete,
+		})
+		if err != nil {
+			log.Fatalf("Error watching services in %s: %v", namespace, err)
+		}
+
+		d.factories = append(d.factories, factory)
+	}
+
+	c.AddAppProvider(d)
+
+	return d
+}
+
+// Apps returns the discovered apps ordered by alias.
+func (d *Discovery) Apps() []config.App {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	apps := make([]config.App, 0, len(d.apps))
+	for _, app := range d.apps {
+		apps = append(apps, app)
+	}
+	slices.SortFunc(apps, func(a, b config.App) int {
+		return strings.Compare(a.Alias, b.Alias)
+	})
+	return apps
+}
+
+// Start watches the Services and returns once the initial list is known.
+func (d *Discovery) Start(ctx context.Context) error {
+	ctx, d.cancel = context.WithCancel(ctx)
+	for _, factory := range d.factories {
+		factory.Start(ctx.Done())
+	}
+
+	for _, factory := range d.factories {
+		for informer, synced := range factory.WaitForCacheSync(ctx.Done()) {
+			if !synced {
+				return fmt.Errorf("error syncing %v", informer)
+			}
+		}
+	}
+	return nil
+}
+
+// Stop stops watching the Services.
+func (d *Discovery) Stop() {
+	if d.cancel != nil {
+		d.cancel()
+	}
+	for _, factory := range d.factories {
+		factory.Shutdown()
+	}
+}
+
+func (d *Discovery) set(obj interface{}) {
+	service, ok := obj.(*corev1.Service)
+	if !ok {
+		return
+	}
+
+	key := service.Namespace + "/" + service.Name
+	app, ok, err := ServiceApp(service)
+	if ok && err == nil && slices.ContainsFunc(d.Config.Apps, func(configured config.App) bool {
+		return configured.Element == app.Element
+	}) {
+		err = fmt.Errorf("element %s belongs to a configured app", app.Element)
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if err != nil {
+		log.Printf("Ignoring app of service %s: %v", key, err)
+	}
+	if !ok || err != nil {
+		delete(d.apps, key)
+		return
+	}
+	d.apps[key] = app
+}
+
+func (d *Discovery) delete(obj interface{}) {
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+	service, ok := obj.(*corev1.Service)
+	if !ok {
+		return
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	delete(d.apps, service.Namespace+"/"+service.Name)
+}
+
+// Namespaces returns the watched namespaces: Namespace and Namespaces,
+// without blanks and duplicates.
+func Namespaces(c *config.Config) []string {
+	namespaces := []string{}
+	for _, namespace := range append([]string{c.Discovery.Namespace}, c.Discovery.Namespaces...) {
+		if namespace = strings.TrimSpace(namespace); namespace != "" && !slices.Contains(namespaces, namespace) {
+			namespaces = append(namespaces, namespace)
+		}
+	}
+	return namespaces
+}
+
+// ServiceApp builds the app described by the annotations of a Service. It
+// reports false when the Service carries none of the app annotations.
+func ServiceApp(service *corev1.Service) (config.App, bool, error) {
+	annotations := service.Annotations
+	if annotations[AnnotationElement] == "" && annotations[AnnotationPath] == "" && annotations[AnnotationTarget] == "" {
+		return config.App{}, false, nil
+	}
+
+	app := config.App{
+		Alias:      annotations[AnnotationAlias],
+		Address:    serviceAddress(service),
+		Element:    annotations[AnnotationElement],
+		HealthPath: annotations[AnnotationHealthPath],
+		Path:       annotations[AnnotationPath],
+	}
+	if app.Alias == "" {
+		app.Alias = service.Name
+	}
+	for _, path := range strings.Split(annotations[AnnotationTarget], ",") {
+		if path = strings.TrimSpace(path); path != "" {
+			app.Targets = append(app.Targets, config.Target{
+				Container: annotations[AnnotationContainer],
+				Path:      path,
+			})
+		}
+	}
+
+	if err := app.Validate(); err != nil {
+		return config.App{}, true, err
+	}
+	return app, true, nil
+}
+
+func serviceAddress(service *corev1.Service) string {
+	address := service.Name + "." + service.Namespace + ".svc"
+
+	port := service.Annotations[AnnotationPort]
+	if port == "" && len(service.Spec.Ports) > 0 {
+		port = fmt.Sprint(service.Spec.Ports[0].Port)
+	}
+	if port == "" || port == "80" {
+		return address
+	}
+	return address + ":" + port
+}
+
+func restConfig(kubeconfig string) (*rest.Config, error) {
+	if kubeconfig != "" {
+		return clientcmd.BuildConfigFromFlags("", kubeconfig)
+	}
+	return rest.InClusterConfig()
+}
@@ -0,0 +1,250 @@
+// Copyright 2025 KDex Tech
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package discovery
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	"kdex.dev/proxy/internal/config"
+)
+
+func service(name string, annotations map[string]string, ports ...int32) *corev1.Service {
+	s := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Annotations: annotations,
+			Labels:      map[string]string{"kdex.dev/app": "true"},
+			Name:        name,
+			Namespace:   "apps",
+		},
+	}
+	for _, port := range ports {
+		s.Spec.Ports = append(s.Spec.Ports, corev1.ServicePort{Port: port})
+	}
+	return s
+}
+
+func TestServiceApp(t *testing.T) {
+	tests := []struct {
+		name    string
+		service *corev1.Service
+		want    config.App
+		wantOk  bool
+		wantErr bool
+	}{
+		{
+			name:    "no annotations",
+			service: service("orders", nil, 80),
+		},
+		{
+			name: "annotated",
+			service: service("orders", map[string]string{
+				AnnotationContainer:  "main",
+				AnnotationElement:    "orders-app",
+				AnnotationHealthPath: "/healthz",
+				AnnotationPath:       "/app.js",
+				AnnotationTarget:     "/orders, /orders/{id}",
+			}, 80),
+			want: config.App{
+				Alias:      "orders",
+				Address:    "orders.apps.svc",
+				Element:    "orders-app",
+				HealthPath: "/healthz",
+				Path:       "/app.js",
+				Targets: []config.Target{
+					{Container: "main", Path: "/orders"},
+					{Container: "main", Path: "/orders/{id}"},
+				},
+			},
+			wantOk: true,
+		},
+		{
+			name: "alias and service port",
+			service: service("orders", map[string]string{
+				AnnotationAlias:   "shop",
+				AnnotationElement: "orders-app",
+				AnnotationPath:    "/app.js",
+				AnnotationTarget:  "/orders",
+			}, 8080),
+			want: config.App{
+				Alias:   "shop",
+				Address: "orders.apps.svc:8080",
+				Element: "orders-app",
+				Path:    "/app.js",
+				Targets: []config.Target{{Path: "/orders"}},
+			},
+			wantOk: true,
+		},
+		{
+			name: "annotated port",
+			service: service("orders", map[string]string{
+				AnnotationElement: "orders-app",
+				AnnotationPath:    "/app.js",
+				AnnotationPort:    "3000",
+				AnnotationTarget:  "/orders",
+			}, 80),
+			want: config.App{
+				Alias:   "orders",
+				Address: "orders.apps.svc:3000",
+				Element: "orders-app",
+				Path:    "/app.js",
+				Targets: []config.Target{{Path: "/orders"}},
+			},
+			wantOk: true,
+		},
+		{
+			name: "missing target",
+			service: service("orders", map[string]string{
+				AnnotationElement: "orders-app",
+				AnnotationPath:    "/app.js",
+			}, 80),
+			wantOk:  true,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok, err := ServiceApp(tt.service)
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tt.wantOk, ok)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestDiscovery(t *testing.T) {
+	annotations := map[string]string{
+		AnnotationElement: "orders-app",
+		AnnotationPath:    "/app.js",
+		AnnotationTarget:  "/orders",
+	}
+
+	inNamespace := func(s *corev1.Service, namespace string) *corev1.Service {
+		s.Namespace = namespace
+		return s
+	}
+
+	client := fake.NewSimpleClientset(
+		service("orders", annotations, 80),
+		inNamespace(service("untrusted", map[string]string{
+			AnnotationElement: "untrusted-app",
+			AnnotationPath:    "/app.js",
+			AnnotationTarget:  "/orders",
+		}, 80), "other"),
+		service("impostor", map[string]string{
+			AnnotationElement: "static-app",
+			AnnotationPath:    "/app.js",
+			AnnotationTarget:  "/",
+		}, 80),
+		inNamespace(service("catalog", map[string]string{
+			AnnotationElement: "catalog-app",
+			AnnotationPath:    "/app.js",
+			AnnotationTarget:  "/catalog",
+		}, 80), "shop"),
+	)
+	c := &config.Config{
+		Apps: []config.App{
+			{Address: "static-app", Alias: "static", Element: "static-app", Path: "/app.js", Targets: []config.Target{{Path: "/"}}},
+		},
+		Discovery: config.DiscoveryConfig{
+			Enabled:       true,
+			LabelSelector: "kdex.dev/app=true",
+			Namespace:     "apps",
+			Namespaces:    []string{"shop"},
+		},
+	}
+	d := newDiscovery(c, client)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	assert.NoError(t, d.Start(ctx))
+	defer d.Stop()
+
+	aliases := func() []string {
+		var aliases []string
+		for _, app := range c.AllApps() {
+			aliases = append(aliases, app.Alias)
+		}
+		return aliases
+	}
+
+	assert.Equal(t, []string{"static", "catalog", "orders"}, aliases(), "services outside the namespaces and impostors of configured elements are ignored")
+	assert.Len(t, c.GetAppsForTargetPath("/orders"), 1)
+
+	_, err := client.CoreV1().Services("apps").Create(ctx, service("billing", map[string]string{
+		AnnotationElement: "billing-app",
+		AnnotationPath:    "/app.js",
+		AnnotationTarget:  "/billing",
+	}, 80), metav1.CreateOptions{})
+	assert.NoError(t, err)
+	assert.Eventually(t, func() bool {
+		return len(aliases()) == 4
+	}, time.Second, 10*time.Millisecond)
+	assert.Equal(t, []string{"static", "billing", "catalog", "orders"}, aliases())
+
+	updated := service("orders", map[string]string{
+		AnnotationElement: "orders-app",
+		AnnotationPath:    "/app.js",
+		AnnotationTarget:  "/shop",
+	}, 80)
+	_, err = client.CoreV1().Services("apps").Update(ctx, updated, metav1.UpdateOptions{})
+	assert.NoError(t, err)
+	assert.Eventually(t, func() bool {
+		return len(c.GetAppsForTargetPath("/shop")) == 1
+	}, time.Second, 10*time.Millisecond)
+	assert.Empty(t, c.GetAppsForTargetPath("/orders"))
+
+	assert.NoError(t, client.CoreV1().Services("apps").Delete(ctx, "billing", metav1.DeleteOptions{}))
+	assert.Eventually(t, func() bool {
+		return len(aliases()) == 3
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestNamespaces(t *testing.T) {
+	tests := []struct {
+		name      string
+		discovery config.DiscoveryConfig
+		want      []string
+	}{
+		{
+			name: "none",
+			want: []string{},
+		},
+		{
+			name:      "namespace",
+			discovery: config.DiscoveryConfig{Namespace: "apps"},
+			want:      []string{"apps"},
+		},
+		{
+			name:      "namespace and namespaces",
+			discovery: config.DiscoveryConfig{Namespace: "apps", Namespaces: []string{"shop", " ", "apps"}},
+			want:      []string{"apps", "shop"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, Namespaces(&config.Config{Discovery: tt.discovery}))
+		})
+	}
+}
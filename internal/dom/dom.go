@@ -29,6 +29,36 @@ func collectText(n *html.Node, buf *bytes.Buffer) {
 	}
 }
 
+// Clone returns a deep copy of the node and its descendants.
+func Clone(n *html.Node) *html.Node {
+	clone := &html.Node{
+		Type:      n.Type,
+		DataAtom:  n.DataAtom,
+		Data:      n.Data,
+		Namespace: n.Namespace,
+		Attr:      append([]html.Attribute(nil), n.Attr...),
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		clone.AppendChild(Clone(c))
+	}
+	return clone
+}
+
+// ReplaceChildren moves the children of src into dst in place of its own.
+func ReplaceChildren(dst *html.Node, src *html.Node) {
+	for c := dst.FirstChild; c != nil; {
+		next := c.NextSibling
+		dst.RemoveChild(c)
+		c = next
+	}
+	for c := src.FirstChild; c != nil; {
+		next := c.NextSibling
+		src.RemoveChild(c)
+		dst.AppendChild(c)
+		c = next
+	}
+}
+
 func FindElementByName(name string, doc *html.Node, predicate func(n *html.Node) bool) *html.Node {
 	var find func(*html.Node) *html.Node
 	find = func(n *html.Node) *html.Node {
@@ -48,8 +78,27 @@ func FindElementByName(name string, doc *html.Node, predicate func(n *html.Node)
 	return find(doc)
 }
 
+func GetAttribute(node *html.Node, key string) string {
+	for _, a := range node.Attr {
+		if a.Namespace == "" && a.Key == key {
+			return a.Val
+		}
+	}
+	return ""
+}
+
 func GetNodeText(node *html.Node) []byte {
 	var buf bytes.Buffer
 	collectText(node, &buf)
 	return buf.Bytes()
 }
+
+func SetAttribute(node *html.Node, key string, value string) {
+	for i, a := range node.Attr {
+		if a.Namespace == "" && a.Key == key {
+			node.Attr[i].Val = value
+			return
+		}
+	}
+	node.Attr = append(node.Attr, html.Attribute{Key: key, Val: value})
+}
@@ -17,8 +17,10 @@ package dom
 import (
 	"bytes"
 	"reflect"
+	"strings"
 	"testing"
 
+	"github.com/stretchr/testify/assert"
 	"golang.org/x/net/html"
 )
 
@@ -134,3 +136,55 @@ func TestGetNodeText(t *testing.T) {
 		})
 	}
 }
+
+func TestSetAttribute(t *testing.T) {
+	tests := []struct {
+		name  string
+		attr  []html.Attribute
+		key   string
+		value string
+		want  []html.Attribute
+	}{
+		{
+			name:  "add attribute",
+			attr:  []html.Attribute{{Key: "id", Val: "a"}},
+			key:   "class",
+			value: "b",
+			want:  []html.Attribute{{Key: "id", Val: "a"}, {Key: "class", Val: "b"}},
+		},
+		{
+			name:  "replace attribute",
+			attr:  []html.Attribute{{Key: "id", Val: "a"}, {Key: "class", Val: "b"}},
+			key:   "class",
+			value: "c",
+			want:  []html.Attribute{{Key: "id", Val: "a"}, {Key: "class", Val: "c"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			n := &html.Node{Type: html.ElementNode, Data: "div", Attr: tt.attr}
+			SetAttribute(n, tt.key, tt.value)
+			if !reflect.DeepEqual(n.Attr, tt.want) {
+				t.Errorf("SetAttribute() = %v, want %v", n.Attr, tt.want)
+			}
+			if got := GetAttribute(n, tt.key); got != tt.value {
+				t.Errorf("GetAttribute() = %v, want %v", got, tt.value)
+			}
+		})
+	}
+}
+
+func TestClone(t *testing.T) {
+	doc, err := html.Parse(strings.NewReader(`<html><body><div id="a">text</div></body></html>`))
+	assert.NoError(t, err)
+
+	clone := Clone(doc)
+	SetAttribute(FindElementByName("div", clone, nil), "id", "b")
+
+	assert.Equal(t, "a", GetAttribute(FindElementByName("div", doc, nil), "id"))
+	assert.Equal(t, "text", string(GetNodeText(FindElementByName("div", clone, nil))))
+
+	ReplaceChildren(doc, clone)
+	assert.Equal(t, "b", GetAttribute(FindElementByName("div", doc, nil), "id"))
+	assert.Nil(t, clone.FirstChild)
+}
@@ -15,20 +15,29 @@
 package engine
 
 import (
+	"context"
 	"log"
 	"net/http"
+	"strings"
 
+	"kdex.dev/proxy/internal/app"
 	"kdex.dev/proxy/internal/authn"
 	"kdex.dev/proxy/internal/authz"
 	"kdex.dev/proxy/internal/check"
 	"kdex.dev/proxy/internal/config"
+	"kdex.dev/proxy/internal/discovery"
 	"kdex.dev/proxy/internal/expression"
 	"kdex.dev/proxy/internal/fileserver"
+	"kdex.dev/proxy/internal/locale"
+	mApp "kdex.dev/proxy/internal/middleware/app"
 	mAuthn "kdex.dev/proxy/internal/middleware/authn"
 	mAuthz "kdex.dev/proxy/internal/middleware/authz"
+	mLocale "kdex.dev/proxy/internal/middleware/locale"
 	mLogger "kdex.dev/proxy/internal/middleware/log"
 	mRoles "kdex.dev/proxy/internal/middleware/roles"
 	"kdex.dev/proxy/internal/proxy"
+	"kdex.dev/proxy/internal/registry"
+	"kdex.dev/proxy/internal/scanner"
 	"kdex.dev/proxy/internal/state"
 
 	"kdex.dev/proxy/internal/httpserver"
@@ -36,7 +45,10 @@ import (
 
 type Engine struct {
 	Config     *config.Config
+	discovery  *discovery.Discovery
+	health     *app.Health
 	httpServer *httpserver.HttpServer
+	integrity  *scanner.Integrity
 }
 
 func NewEngine(config *config.Config) *Engine {
@@ -50,16 +62,34 @@ func NewEngine(config *config.Config) *Engine {
 	}
 
 	// Components
+	engine.discovery = discovery.NewDiscovery(config)
+	engine.health = app.NewHealth(config)
+	if config.Importmap.Integrity.Enabled {
+		engine.integrity = scanner.NewIntegrity(config.ModuleDir, config.Importmap.Integrity.Refresh)
+	}
+	appRegistry := registry.NewRegistry(config)
+	appAccess := app.NewAccess(config)
+	assetProxy := app.NewAssetProxy(config)
 	checker := check.NewChecker(config)
 	authorizer := authz.NewAuthorizer(checker)
 	authValidator := authn.AuthValidatorFactory(config)
 	authValidator.Register(mux)
 	fieldEvaluator := expression.NewFieldEvaluator(config)
 	fileServer := fileserver.NewFileServer(config)
-	proxyServer := proxy.NewProxy(config)
-	stateHandler := &state.StateHandler{FieldEvaluator: fieldEvaluator}
+	localizer := locale.NewLocalizer(config)
+	proxyServer := proxy.NewProxy(config, proxy.Components{
+		Health:    engine.health,
+		Integrity: engine.integrity,
+		Localizer: localizer,
+	})
+	stateHandler := state.NewStateHandler(config)
 
 	// Middleware
+	appMiddleware := &mApp.AppMiddleware{
+		Access:    appAccess,
+		Config:    config,
+		Localizer: localizer,
+	}
 	authnMiddleware := &mAuthn.AuthnMiddleware{
 		AuthenticateHeader:     config.Authn.AuthenticateHeader,
 		AuthenticateStatusCode: config.Authn.AuthenticateStatusCode,
@@ -73,6 +103,10 @@ func NewEngine(config *config.Config) *Engine {
 	}
 	authzMiddleware := &mAuthz.AuthzMiddleware{
 		Authorizer: authorizer,
+		Localizer:  localizer,
+	}
+	localeMiddleware := &mLocale.LocaleMiddleware{
+		Localizer: localizer,
 	}
 
 	// Handlers
@@ -81,6 +115,30 @@ func NewEngine(config *config.Config) *Engine {
 		loggerMiddleware.Log(fileServer.ServeHTTP(), false),
 	)
 
+	if assetProxy != nil {
+		mux.Handle(
+			"GET "+config.AppAssets.Prefix,
+			loggerMiddleware.Log(
+				authnMiddleware.Authn(
+					rolesMiddleware.InjectRoles(assetProxy),
+				),
+				false,
+			),
+		)
+	}
+
+	if appRegistry != nil {
+		registryHandler := loggerMiddleware.Log(
+			authnMiddleware.Authn(
+				rolesMiddleware.InjectRoles(appRegistry.Handler()),
+			),
+			false,
+		)
+		endpoint := strings.TrimSuffix(config.Registry.Endpoint, "/")
+		mux.Handle(endpoint, registryHandler)
+		mux.Handle(endpoint+"/", registryHandler)
+	}
+
 	mux.Handle(
 		"GET "+config.Proxy.ProbePath,
 		loggerMiddleware.Log(http.HandlerFunc(proxyServer.Probe), true),
@@ -131,10 +189,14 @@ func NewEngine(config *config.Config) *Engine {
 	mux.Handle(
 		"/",
 		loggerMiddleware.Log(
-			authnMiddleware.Authn(
-				rolesMiddleware.InjectRoles(
-					authzMiddleware.Authz(
-						http.HandlerFunc(proxyServer.ReverseProxy()),
+			localeMiddleware.InjectLocale(
+				authnMiddleware.Authn(
+					rolesMiddleware.InjectRoles(
+						authzMiddleware.Authz(
+							appMiddleware.Authz(
+								http.HandlerFunc(proxyServer.ReverseProxy()),
+							),
+						),
 					),
 				),
 			),
@@ -146,10 +208,30 @@ func NewEngine(config *config.Config) *Engine {
 }
 
 func (e *Engine) Start() error {
+	if e.discovery != nil {
+		if err := e.discovery.Start(context.Background()); err != nil {
+			log.Fatalf("Error discovering apps: %v", err)
+		}
+	}
+	if e.health != nil {
+		e.health.Start(context.Background())
+	}
+	if e.integrity != nil {
+		e.integrity.Start(context.Background())
+	}
 	e.httpServer.Start()
 	return nil
 }
 
 func (e *Engine) Stop() error {
+	if e.discovery != nil {
+		e.discovery.Stop()
+	}
+	if e.health != nil {
+		e.health.Stop()
+	}
+	if e.integrity != nil {
+		e.integrity.Stop()
+	}
 	return nil
 }
@@ -17,9 +17,16 @@ package expression
 import (
 	"fmt"
 	"log"
+	"net/http"
+	"reflect"
+	"strings"
 
 	"github.com/google/cel-go/cel"
 	"github.com/google/cel-go/checker/decls"
+	"github.com/google/cel-go/common/types"
+	"github.com/google/cel-go/common/types/ref"
+	"google.golang.org/protobuf/types/known/structpb"
+	kctx "kdex.dev/proxy/internal/context"
 )
 
 type Evaluator struct {
@@ -30,6 +37,7 @@ func NewEvaluator() *Evaluator {
 	env, err := cel.NewEnv(
 		cel.Declarations(
 			decls.NewVar("data", decls.NewMapType(decls.String, decls.Any)),
+			decls.NewVar("request", decls.NewMapType(decls.String, decls.Any)),
 		),
 	)
 	if err != nil {
@@ -40,6 +48,70 @@ func NewEvaluator() *Evaluator {
 }
 
 func (e *Evaluator) Evaluate(expression string, data map[string]interface{}) (any, error) {
+	return e.EvaluateWith(expression, map[string]interface{}{
+		"data": data,
+	})
+}
+
+// EvaluateWith evaluates the expression against an arbitrary set of the
+// declared variables, e.g. "data" for session claims and "request" for
+// RequestData.
+func (e *Evaluator) EvaluateWith(expression string, vars map[string]interface{}) (any, error) {
+	out, err := e.eval(expression, vars)
+	if err != nil {
+		return nil, err
+	}
+
+	return out.Value(), nil
+}
+
+// EvaluateJSON evaluates the expression against the "data" variable and
+// converts the result, including CEL lists and maps, to the plain values
+// encoding/json understands.
+func (e *Evaluator) EvaluateJSON(expression string, data map[string]interface{}) (any, error) {
+	out, err := e.eval(expression, map[string]interface{}{
+		"data": data,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return Native(out)
+}
+
+// Native converts an expression result, including CEL lists and maps, to the
+// plain values encoding/json understands. Numbers become float64.
+func Native(result any) (any, error) {
+	value, ok := result.(ref.Val)
+	if !ok {
+		value = types.DefaultTypeAdapter.NativeToValue(result)
+	}
+
+	converted, err := value.ConvertToNative(reflect.TypeOf(&structpb.Value{}))
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert result: %v", err)
+	}
+
+	return converted.(*structpb.Value).AsInterface(), nil
+}
+
+func (e *Evaluator) eval(expression string, vars map[string]interface{}) (ref.Val, error) {
+	program, err := e.Compile(expression)
+	if err != nil {
+		return nil, err
+	}
+
+	return program.eval(vars)
+}
+
+// Program is an expression compiled once, so it can be validated up front
+// and evaluated for every request.
+type Program struct {
+	prg cel.Program
+}
+
+// Compile compiles the expression against the declared variables.
+func (e *Evaluator) Compile(expression string) (*Program, error) {
 	ast, iss := e.env.Compile(expression)
 	if iss.Err() != nil {
 		return nil, fmt.Errorf("failed to compile expression: %v", iss.Err())
@@ -50,12 +122,57 @@ func (e *Evaluator) Evaluate(expression string, data map[string]interface{}) (an
 		return nil, fmt.Errorf("failed to create program: %v", err)
 	}
 
-	out, _, err := prg.Eval(map[string]interface{}{
-		"data": data,
-	})
+	return &Program{prg: prg}, nil
+}
+
+// EvaluateWith evaluates the program like Evaluator.EvaluateWith.
+func (p *Program) EvaluateWith(vars map[string]interface{}) (any, error) {
+	out, err := p.eval(vars)
 	if err != nil {
-		return nil, fmt.Errorf("failed to evaluate expression: %v", err)
+		return nil, err
 	}
 
 	return out.Value(), nil
 }
+
+func (p *Program) eval(vars map[string]interface{}) (ref.Val, error) {
+	out, _, err := p.prg.Eval(vars)
+	if err != nil {
+		return nil, fmt.Errorf("failed to evaluate expression: %v", err)
+	}
+
+	return out, nil
+}
+
+// RequestData exposes the parts of a request expressions may inspect as the
+// "request" variable. For proxied requests the public path and host are used
+// rather than the upstream ones.
+func RequestData(r *http.Request) map[string]interface{} {
+	path := r.URL.Path
+	if p, ok := r.Context().Value(kctx.RequestPathKey).(string); ok {
+		path = p
+	}
+
+	host := r.Host
+	if origin, ok := r.Context().Value(kctx.PublicOriginKey).(kctx.PublicOrigin); ok {
+		host = origin.Host
+	}
+
+	headers := make(map[string]interface{}, len(r.Header))
+	for key := range r.Header {
+		headers[strings.ToLower(key)] = r.Header.Get(key)
+	}
+
+	query := make(map[string]interface{})
+	for key := range r.URL.Query() {
+		query[key] = r.URL.Query().Get(key)
+	}
+
+	return map[string]interface{}{
+		"headers": headers,
+		"host":    host,
+		"method":  r.Method,
+		"path":    path,
+		"query":   query,
+	}
+}
@@ -87,3 +87,43 @@ func TestEvaluator_Evaluate(t *testing.T) {
 		})
 	}
 }
+
+func TestNative(t *testing.T) {
+	e := NewEvaluator()
+	tests := []struct {
+		name       string
+		expression string
+		want       any
+	}{
+		{
+			name:       "null",
+			expression: "null",
+			want:       nil,
+		},
+		{
+			name:       "integer",
+			expression: "data.age",
+			want:       float64(25),
+		},
+		{
+			name:       "list",
+			expression: "[data.name, 1, true]",
+			want:       []interface{}{"John", float64(1), true},
+		},
+		{
+			name:       "map",
+			expression: `{"name": data.name, "roles": data.roles}`,
+			want:       map[string]interface{}{"name": "John", "roles": []interface{}{"admin"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := e.Evaluate(tt.expression, map[string]interface{}{"age": 25, "name": "John", "roles": []string{"admin"}})
+			assert.NoError(t, err)
+
+			got, err := Native(result)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
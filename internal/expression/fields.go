@@ -16,6 +16,7 @@ package expression
 
 import (
 	"fmt"
+	"strings"
 
 	"kdex.dev/proxy/internal/config"
 )
@@ -63,3 +64,25 @@ func (e *FieldEvaluator) EvaluateRoles(data map[string]interface{}) ([]string, e
 		return nil, fmt.Errorf("expression must evaluate to a list of strings; got %T for %v", v, result)
 	}
 }
+
+func (e *FieldEvaluator) EvaluateScopes(data map[string]interface{}) ([]string, error) {
+	result, err := e.Evaluator.Evaluate(e.Config.Expressions.Scopes, data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to evaluate expression: %v", err)
+	}
+
+	switch v := result.(type) {
+	case string:
+		return strings.Fields(v), nil
+	case []interface{}:
+		scopes := make([]string, len(v))
+		for i, v := range v {
+			scopes[i] = fmt.Sprint(v)
+		}
+		return scopes, nil
+	case []string:
+		return v, nil
+	default:
+		return nil, fmt.Errorf("expression must evaluate to a string or a list of strings; got %T for %v", v, result)
+	}
+}
@@ -0,0 +1,102 @@
+// Copyright 2025 KDex Tech
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package headers
+
+import (
+	"net/http"
+	"strings"
+
+	"kdex.dev/proxy/internal/config"
+	kctx "kdex.dev/proxy/internal/context"
+	"kdex.dev/proxy/internal/util"
+)
+
+// HeaderModifier applies the configured header rules to requests sent
+// upstream and to responses sent to clients.
+type HeaderModifier struct {
+	Rules []config.HeaderRule
+}
+
+func NewHeaderModifier(config *config.Config) *HeaderModifier {
+	return &HeaderModifier{
+		Rules: config.Proxy.Headers.Rules,
+	}
+}
+
+// ModifyRequest applies the request actions of the rules matching the
+// incoming request to the outgoing one.
+func (m *HeaderModifier) ModifyRequest(in *http.Request, out *http.Request) {
+	for _, rule := range m.Rules {
+		if Matches(rule, in.Method, in.URL.Path) {
+			apply(rule.Request, out.Header)
+		}
+	}
+}
+
+// ModifyResponse applies the response actions of the rules matching the
+// request that produced the response.
+func (m *HeaderModifier) ModifyResponse(r *http.Response) {
+	path, ok := r.Request.Context().Value(kctx.RequestPathKey).(string)
+	if !ok {
+		path = r.Request.URL.Path
+	}
+
+	for _, rule := range m.Rules {
+		if Matches(rule, r.Request.Method, path) {
+			apply(rule.Response, r.Header)
+		}
+	}
+}
+
+// Matches reports whether the rule applies to the method and path. Empty
+// matchers match everything; a path ending in "*" matches by prefix.
+func Matches(rule config.HeaderRule, method string, path string) bool {
+	if len(rule.Methods) > 0 {
+		found := false
+		for _, m := range rule.Methods {
+			if strings.EqualFold(m, method) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	if len(rule.Paths) == 0 {
+		return true
+	}
+
+	for _, p := range rule.Paths {
+		if util.MatchPath(p, path) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func apply(actions config.HeaderActions, header http.Header) {
+	for _, name := range actions.Remove {
+		header.Del(name)
+	}
+	for name, value := range actions.Set {
+		header.Set(name, value)
+	}
+	for name, value := range actions.Add {
+		header.Add(name, value)
+	}
+}
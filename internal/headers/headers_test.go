@@ -0,0 +1,117 @@
+// Copyright 2025 KDex Tech
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package headers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"kdex.dev/proxy/internal/config"
+	kctx "kdex.dev/proxy/internal/context"
+)
+
+var testRules = []config.HeaderRule{
+	{
+		Response: config.HeaderActions{
+			Remove: []string{"Server", "X-Powered-By"},
+		},
+	},
+	{
+		Paths: []string{"/assets/*"},
+		Response: config.HeaderActions{
+			Set: map[string]string{"Cache-Control": "public, max-age=3600"},
+		},
+	},
+	{
+		Methods: []string{"post"},
+		Paths:   []string{"/api"},
+		Request: config.HeaderActions{
+			Set: map[string]string{"X-Tenant": "acme"},
+		},
+	},
+}
+
+func TestHeaderModifier_ModifyRequest(t *testing.T) {
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		want   http.Header
+	}{
+		{
+			name:   "matching method and path",
+			method: "POST",
+			path:   "/api",
+			want:   http.Header{"Accept": {"*/*"}, "X-Tenant": {"acme"}},
+		},
+		{
+			name:   "wrong method",
+			method: "GET",
+			path:   "/api",
+			want:   http.Header{"Accept": {"*/*"}},
+		},
+		{
+			name:   "wrong path",
+			method: "POST",
+			path:   "/api/other",
+			want:   http.Header{"Accept": {"*/*"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := &HeaderModifier{Rules: testRules}
+			in := httptest.NewRequest(tt.method, tt.path, nil)
+			out := httptest.NewRequest(tt.method, "/upstream", nil)
+			out.Header = http.Header{"Accept": {"*/*"}}
+			m.ModifyRequest(in, out)
+			assert.Equal(t, tt.want, out.Header)
+		})
+	}
+}
+
+func TestHeaderModifier_ModifyResponse(t *testing.T) {
+	tests := []struct {
+		name   string
+		path   string
+		header http.Header
+		want   http.Header
+	}{
+		{
+			name:   "strip server headers",
+			path:   "/",
+			header: http.Header{"Server": {"nginx"}, "X-Powered-By": {"PHP"}, "Content-Type": {"text/html"}},
+			want:   http.Header{"Content-Type": {"text/html"}},
+		},
+		{
+			name:   "cache assets",
+			path:   "/assets/app.css",
+			header: http.Header{"Cache-Control": {"no-cache"}},
+			want:   http.Header{"Cache-Control": {"public, max-age=3600"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := &HeaderModifier{Rules: testRules}
+			req := httptest.NewRequest("GET", "/upstream/prefix"+tt.path, nil)
+			req = req.WithContext(context.WithValue(req.Context(), kctx.RequestPathKey, tt.path))
+			r := &http.Response{Header: tt.header, Request: req}
+			m.ModifyResponse(r)
+			assert.Equal(t, tt.want, r.Header)
+		})
+	}
+}
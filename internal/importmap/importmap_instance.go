@@ -114,6 +114,27 @@ func (importMapInstance *ImportMapInstance) Mutate() {
 	// Add new text node
 	importMapInstance.mapNode.AppendChild(newTextNode)
 
+	// Preload the modules whose integrity is known, so it is checked
+	if headNode := dom.FindElementByName("head", importMapInstance.docNode, nil); headNode != nil {
+		for _, module := range importMapInstance.preloadModules {
+			href := importMapInstance.importMap.Imports[module]
+			integrity, ok := importMapInstance.importMap.Integrity[href]
+			if href == "" || !ok {
+				continue
+			}
+
+			headNode.AppendChild(&html.Node{
+				Type: html.ElementNode,
+				Data: "link",
+				Attr: []html.Attribute{
+					{Key: "rel", Val: "modulepreload"},
+					{Key: "href", Val: href},
+					{Key: "integrity", Val: integrity},
+				},
+			})
+		}
+	}
+
 	// Append a new import script node to the bottom of the body
 	if len(importMapInstance.preloadModules) > 0 {
 		bodyNode := dom.FindElementByName("body", importMapInstance.docNode, nil)
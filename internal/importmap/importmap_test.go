@@ -15,10 +15,20 @@
 package importmap
 
 import (
+	"context"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"reflect"
+	"strings"
 	"testing"
 
+	"github.com/stretchr/testify/assert"
 	"golang.org/x/net/html"
+	"kdex.dev/proxy/internal/canary"
+	"kdex.dev/proxy/internal/config"
+	kctx "kdex.dev/proxy/internal/context"
+	"kdex.dev/proxy/internal/scanner"
 	"kdex.dev/proxy/internal/util"
 )
 
@@ -74,3 +84,201 @@ func TestImportMapManager_Mutate(t *testing.T) {
 		})
 	}
 }
+
+func TestImportMapTransformer_Mutator(t *testing.T) {
+	c := &config.Config{
+		AppAssets: config.AppAssetsConfig{Enabled: true, Prefix: "/~/apps/"},
+		Apps: []config.App{
+			{Address: "test-app", Alias: "ta", CanaryAddress: "test-app-canary", Element: "test-app", Path: "/dist/app.js"},
+		},
+		Fileserver: config.FileserverConfig{Prefix: "/~/m/"},
+	}
+	transformer := &ImportMapTransformer{
+		Config:        c,
+		ModuleImports: map[string]string{"@kdex/ui": "@kdex/ui/index.js"},
+	}
+
+	r := httptest.NewRequest("GET", "/posts", nil)
+	im := &ImportMap{Imports: map[string]string{}}
+	transformer.Mutator(r)(im)
+	assert.Equal(t, map[string]string{
+		"@kdex/ui":  "/~/m/@kdex/ui/index.js",
+		"test-app":  "/~/apps/ta/dist/app.js",
+		"test-app/": "/~/apps/ta/",
+	}, im.Imports)
+
+	r = r.WithContext(context.WithValue(r.Context(), kctx.VariantKey, kctx.Variant{Name: canary.Canary}))
+	im = &ImportMap{Imports: map[string]string{}}
+	transformer.Mutator(r)(im)
+	assert.Equal(t, "/~/apps/ta@canary/dist/app.js", im.Imports["test-app"])
+}
+
+func writeModule(t *testing.T, dir string, version string) {
+	t.Helper()
+	assert.NoError(t, os.MkdirAll(dir, 0o755))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "package.json"), []byte(`{"type": "module", "main": "index.js", "version": "`+version+`"}`), 0o644))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "index.js"), []byte(`export const version = "`+version+`";`), 0o644))
+}
+
+func TestImportMapTransformer_scopes(t *testing.T) {
+	moduleDir := t.TempDir()
+	writeModule(t, filepath.Join(moduleDir, "lit"), "3.0.0")
+	writeModule(t, filepath.Join(moduleDir, "apps", "orders", "lit"), "2.0.0")
+	writeModule(t, filepath.Join(moduleDir, "apps", "billing", "lit"), "1.0.0")
+	writeModule(t, filepath.Join(moduleDir, "apps", "billing", "unused"), "1.0.0")
+	assert.NoError(t, os.WriteFile(filepath.Join(moduleDir, "apps", "billing", "package.json"), []byte(`{"dependencies": {"lit": "1.0.0"}}`), 0o644))
+
+	c := &config.Config{
+		Apps: []config.App{
+			{Address: "orders", Alias: "orders", Element: "orders-app", ModuleDir: "apps/orders", Path: "/app.js"},
+			{Address: "billing", Alias: "billing", Element: "billing-app", ModuleDir: "apps/billing/", Path: "/app.js"},
+			{Address: "orders", Alias: "reports", Element: "reports-app", ModuleDir: "apps/billing", Path: "/reports.js"},
+			{Address: "plain", Alias: "plain", Element: "plain-app", Path: "/app.js"},
+		},
+		Fileserver: config.FileserverConfig{Prefix: "/~/m/"},
+		ModuleDir:  moduleDir,
+	}
+	transformer := &ImportMapTransformer{Config: c}
+	assert.NoError(t, transformer.ScanForImports())
+
+	assert.Equal(t, map[string]string{"lit": "lit/index.js"}, transformer.ModuleImports)
+	assert.Equal(t, map[string]string{"lit": "apps/billing/lit/index.js"}, transformer.AppImports(c.Apps[1]))
+	assert.Equal(t, []string{
+		"app orders imports lit from apps/orders/lit/index.js instead of lit/index.js",
+		"app billing imports lit from apps/billing/lit/index.js instead of lit/index.js",
+		"app reports imports lit from apps/billing/lit/index.js instead of lit/index.js",
+		"apps orders and reports share a scope but import lit from apps/orders/lit/index.js and apps/billing/lit/index.js",
+	}, transformer.Conflicts())
+
+	r := httptest.NewRequest("GET", "/posts", nil)
+	im := &ImportMap{Imports: map[string]string{}}
+	transformer.Mutator(r)(im)
+	assert.Equal(t, map[string]string{"lit": "/~/m/lit/index.js"}, im.Imports)
+	assert.Equal(t, map[string]map[string]string{
+		"http://orders/":  {"lit": "/~/m/apps/billing/lit/index.js"},
+		"http://billing/": {"lit": "/~/m/apps/billing/lit/index.js"},
+	}, im.Scopes)
+
+	c.AppAssets = config.AppAssetsConfig{Enabled: true, Prefix: "/~/apps/"}
+	assert.Len(t, transformer.Conflicts(), 3)
+
+	im = &ImportMap{Imports: map[string]string{}}
+	transformer.Mutator(r)(im)
+	assert.Equal(t, map[string]map[string]string{
+		"/~/apps/orders/":  {"lit": "/~/m/apps/orders/lit/index.js"},
+		"/~/apps/billing/": {"lit": "/~/m/apps/billing/lit/index.js"},
+		"/~/apps/reports/": {"lit": "/~/m/apps/billing/lit/index.js"},
+	}, im.Scopes)
+}
+
+type appProvider struct {
+	apps []config.App
+}
+
+func (p *appProvider) Apps() []config.App {
+	return p.apps
+}
+
+func TestImportMapTransformer_dynamicApps(t *testing.T) {
+	moduleDir := t.TempDir()
+	writeModule(t, filepath.Join(moduleDir, "lit"), "3.0.0")
+	writeModule(t, filepath.Join(moduleDir, "apps", "orders", "chart"), "1.0.0")
+
+	provider := &appProvider{}
+	c := &config.Config{
+		Fileserver: config.FileserverConfig{Prefix: "/~/m/"},
+		ModuleDir:  moduleDir,
+	}
+	c.AddAppProvider(provider)
+	transformer := &ImportMapTransformer{Config: c}
+	assert.NoError(t, transformer.ScanForImports())
+
+	r := httptest.NewRequest("GET", "/posts", nil)
+	mutate := func() *ImportMap {
+		im := &ImportMap{Imports: map[string]string{}}
+		transformer.Mutator(r)(im)
+		return im
+	}
+
+	assert.Contains(t, mutate().Imports, "apps/orders/chart", "without apps every module is global")
+
+	provider.apps = []config.App{
+		{Address: "orders", Alias: "orders", Element: "orders-app", ModuleDir: "apps/orders", Path: "/app.js"},
+	}
+	assert.Contains(t, mutate().Imports, "apps/orders/chart", "requests don't scan")
+
+	transformer.Refresh()
+	im := mutate()
+	assert.Equal(t, map[string]string{"lit": "/~/m/lit/index.js"}, im.Imports, "module dirs of added apps are excluded")
+	assert.Equal(t, map[string]map[string]string{
+		"http://orders/": {"chart": "/~/m/apps/orders/chart/index.js"},
+	}, im.Scopes)
+
+	writeModule(t, filepath.Join(moduleDir, "apps", "billing", "chart"), "2.0.0")
+	provider.apps[0].ModuleDir = "apps/billing"
+	transformer.Refresh()
+	im = mutate()
+	assert.Equal(t, map[string]string{"lit": "/~/m/lit/index.js", "apps/orders/chart": "/~/m/apps/orders/chart/index.js"}, im.Imports)
+	assert.Equal(t, map[string]map[string]string{
+		"http://orders/": {"chart": "/~/m/apps/billing/chart/index.js"},
+	}, im.Scopes, "app imports are scanned again when the apps change")
+}
+
+func TestImportMapTransformer_integrity(t *testing.T) {
+	moduleDir := t.TempDir()
+	writeModule(t, filepath.Join(moduleDir, "@kdex", "ui"), "1.0.0")
+	writeModule(t, filepath.Join(moduleDir, "apps", "orders", "dist"), "1.0.0")
+	assert.NoError(t, os.WriteFile(filepath.Join(moduleDir, "apps", "orders", "dist", "app.js"), []byte(`import "lit";`), 0o644))
+
+	c := &config.Config{
+		Apps: []config.App{
+			{Address: "orders", Alias: "orders", CanaryAddress: "orders-canary", Element: "orders-app", ModuleDir: "apps/orders", Path: "/dist/app.js"},
+		},
+		Fileserver: config.FileserverConfig{Prefix: "/~/m/"},
+		Importmap:  config.ImportmapConfig{PreloadModules: []string{"@kdex/ui"}},
+		ModuleDir:  moduleDir,
+	}
+	transformer := &ImportMapTransformer{Config: c, Integrity: scanner.NewIntegrity(moduleDir, 0)}
+	assert.NoError(t, transformer.ScanForImports())
+
+	uiIntegrity := scanner.Hash([]byte(`export const version = "1.0.0";`))
+
+	r := httptest.NewRequest("GET", "/posts", nil)
+	im := &ImportMap{Imports: map[string]string{}}
+	transformer.Mutator(r)(im)
+	assert.Equal(t, map[string]string{
+		"/~/m/@kdex/ui/index.js":         uiIntegrity,
+		"/~/m/apps/orders/dist/app.js":   scanner.Hash([]byte(`import "lit";`)),
+		"/~/m/apps/orders/dist/index.js": uiIntegrity,
+	}, im.Integrity, "scripts served by app backends have no integrity")
+
+	// The canary backend serves other content than the module dir
+	canaryRequest := r.WithContext(context.WithValue(r.Context(), kctx.VariantKey, kctx.Variant{Name: canary.Canary}))
+	c.AppAssets = config.AppAssetsConfig{Enabled: true, Prefix: "/~/apps/"}
+	im = &ImportMap{Imports: map[string]string{}}
+	transformer.Mutator(canaryRequest)(im)
+	assert.Equal(t, "/~/apps/orders@canary/dist/app.js", im.Imports["orders-app"])
+	for url := range im.Integrity {
+		assert.True(t, strings.HasPrefix(url, "/~/m/"), "%s has integrity", url)
+	}
+	c.AppAssets = config.AppAssetsConfig{}
+
+	doc := util.ToDoc(`<html><head></head><body></body></html>`)
+	Instance(doc).WithMutator(transformer.Mutator(r)).WithPreloadModules(c.Importmap.PreloadModules).Mutate()
+	assert.Contains(t, util.FromDoc(doc), `<link rel="modulepreload" href="/~/m/@kdex/ui/index.js" integrity="`+uiIntegrity+`"/>`)
+
+	variantKey := transformer.VariantKey(r)
+	assert.NotEmpty(t, variantKey)
+
+	// Changed modules are hashed again by the next scan
+	assert.NoError(t, os.WriteFile(filepath.Join(moduleDir, "@kdex", "ui", "index.js"), []byte(`export const version = "1.0.1";`), 0o644))
+	im = &ImportMap{Imports: map[string]string{}}
+	transformer.Mutator(r)(im)
+	assert.Equal(t, uiIntegrity, im.Integrity["/~/m/@kdex/ui/index.js"], "requests don't scan")
+
+	transformer.Integrity.Scan()
+	im = &ImportMap{Imports: map[string]string{}}
+	transformer.Mutator(r)(im)
+	assert.Equal(t, scanner.Hash([]byte(`export const version = "1.0.1";`)), im.Integrity["/~/m/@kdex/ui/index.js"])
+	assert.NotEqual(t, variantKey, transformer.VariantKey(r), "the variant key follows the integrity")
+}
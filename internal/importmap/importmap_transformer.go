@@ -15,25 +15,54 @@
 package importmap
 
 import (
+	"fmt"
 	"log"
 	"net/http"
+	"path/filepath"
 	"slices"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"golang.org/x/net/html"
+	"kdex.dev/proxy/internal/app"
+	"kdex.dev/proxy/internal/canary"
 	"kdex.dev/proxy/internal/config"
+	kctx "kdex.dev/proxy/internal/context"
 	"kdex.dev/proxy/internal/scanner"
 	"kdex.dev/proxy/internal/transform"
+	"kdex.dev/proxy/internal/util"
 )
 
+// appsRefresh is how often the imports are scanned again for the apps added
+// or removed at runtime.
+const appsRefresh = time.Second
+
 type ImportMapTransformer struct {
 	transform.Transformer
 	Config        *config.Config
-	ModuleImports map[string]string
+	Integrity     *scanner.Integrity
+	ModuleImports map[string]string // Global imports used until the first scan
+	refreshing    sync.Mutex
+	snapshot      atomic.Pointer[importsSnapshot]
+}
+
+// importsSnapshot is the result of a scan, replaced as a whole by the next.
+type importsSnapshot struct {
+	appImports    map[string]map[string]string // By app module dir
+	appsHash      uint32                       // Of the config the apps were scanned for
+	excluded      []string                     // Module dirs left out of moduleImports
+	moduleImports map[string]string
 }
 
-func NewImportMapTransformer(c *config.Config) *ImportMapTransformer {
+// NewImportMapTransformer uses the engine's module integrity, which is nil
+// unless integrity is enabled. When apps may change at runtime the imports
+// are scanned again in the background.
+func NewImportMapTransformer(c *config.Config, integrity *scanner.Integrity) *ImportMapTransformer {
 	transformer := &ImportMapTransformer{
-		Config: c,
+		Config:    c,
+		Integrity: integrity,
 	}
 
 	if !slices.Contains(transformer.Config.Importmap.PreloadModules, "@kdex/ui") {
@@ -44,21 +73,182 @@ func NewImportMapTransformer(c *config.Config) *ImportMapTransformer {
 		log.Fatal(err)
 	}
 
+	for _, conflict := range transformer.Conflicts() {
+		log.Printf("Import conflict: %s", conflict)
+	}
+
+	if c.DynamicApps() {
+		go func() {
+			for range time.Tick(appsRefresh) {
+				transformer.Refresh()
+			}
+		}()
+	}
+
 	return transformer
 }
 
 func (t *ImportMapTransformer) ScanForImports() error {
-	s := scanner.NewScanner(t.Config.ModuleDir)
+	t.refreshing.Lock()
+	defer t.refreshing.Unlock()
 
-	if err := s.ScanRootDir(); err != nil {
+	snapshot, err := t.scan(nil)
+	if err != nil {
 		return err
 	}
 
+	t.ModuleImports = snapshot.moduleImports
+	t.snapshot.Store(snapshot)
+
+	return nil
+}
+
+// Refresh catches up with the apps added or removed at runtime: the module
+// dirs of the current apps are left out of the global imports and the apps'
+// own imports are scanned again. Requests keep the previous imports until
+// the scan is done.
+func (t *ImportMapTransformer) Refresh() {
+	t.refreshing.Lock()
+	defer t.refreshing.Unlock()
+
+	previous := t.snapshot.Load()
+	if previous != nil && previous.appsHash == t.Config.Hash() {
+		return
+	}
+
+	snapshot, err := t.scan(previous)
+	if err != nil {
+		log.Printf("Error scanning for imports: %v", err)
+		return
+	}
+
+	t.snapshot.Store(snapshot)
+}
+
+// scan scans the imports of the current apps. The global imports of the
+// previous scan are reused while the apps' module dirs stay the same.
+func (t *ImportMapTransformer) scan(previous *importsSnapshot) (*importsSnapshot, error) {
+	snapshot := &importsSnapshot{
+		appImports: map[string]map[string]string{},
+		appsHash:   t.Config.Hash(),
+	}
+
+	apps := t.Config.AllApps()
+
+	// Apps' own dependencies are only imported through their scopes
+	snapshot.excluded = moduleDirs(apps)
+
+	if previous != nil && slices.Equal(previous.excluded, snapshot.excluded) {
+		snapshot.moduleImports = previous.moduleImports
+	} else {
+		s := scanner.NewScanner(t.Config.ModuleDir)
+		s.Exclude = append(s.Exclude, snapshot.excluded...)
+
+		if err := s.ScanRootDir(); err != nil {
+			return nil, err
+		}
+
+		s.ValidateImports()
+
+		snapshot.moduleImports = s.GetImports()
+	}
+
+	for _, moduleDir := range snapshot.excluded {
+		snapshot.appImports[moduleDir] = t.scanAppImports(moduleDir)
+	}
+
+	return snapshot, nil
+}
+
+// scanAppImports scans the imports of an app module dir, by import name,
+// relative to the module dir.
+func (t *ImportMapTransformer) scanAppImports(moduleDir string) map[string]string {
+	s := scanner.NewScanner(filepath.Join(t.Config.ModuleDir, moduleDir))
+	if err := s.ScanAppDir(); err != nil {
+		log.Printf("Error scanning module dir %s: %v", moduleDir, err)
+	}
 	s.ValidateImports()
 
-	t.ModuleImports = s.GetImports()
+	imports := make(map[string]string, len(s.Imports))
+	for name, importPath := range s.GetImports() {
+		imports[name] = filepath.Join(moduleDir, importPath)
+	}
+	return imports
+}
+
+// imports returns the last scan, or ModuleImports before any.
+func (t *ImportMapTransformer) imports() *importsSnapshot {
+	if snapshot := t.snapshot.Load(); snapshot != nil {
+		return snapshot
+	}
+	return &importsSnapshot{moduleImports: t.ModuleImports}
+}
 
-	return nil
+func moduleDirs(apps []config.App) []string {
+	dirs := []string{}
+	for _, a := range apps {
+		if a.ModuleDir != "" {
+			dirs = append(dirs, filepath.Clean(a.ModuleDir))
+		}
+	}
+	sort.Strings(dirs)
+	return slices.Compact(dirs)
+}
+
+// AppImports returns the imports of the app's own dependencies, by import
+// name, relative to the module dir, as of the last scan.
+func (t *ImportMapTransformer) AppImports(a config.App) map[string]string {
+	if a.ModuleDir == "" {
+		return nil
+	}
+	return t.imports().appImports[filepath.Clean(a.ModuleDir)]
+}
+
+// Conflicts describes the dependencies of the configured apps that differ
+// from the global imports or from those of another app in the same scope.
+// Scopes keep apps apart unless they share an address while their assets
+// aren't served same-origin.
+func (t *ImportMapTransformer) Conflicts() []string {
+	var conflicts []string
+
+	moduleImports := t.imports().moduleImports
+
+	scopes := map[string]config.App{}
+	for _, a := range t.Config.Apps {
+		imports := t.AppImports(a)
+		if len(imports) == 0 {
+			continue
+		}
+
+		names := util.Keys(imports)
+		sort.Strings(names)
+
+		for _, name := range names {
+			if global, ok := moduleImports[name]; ok && global != imports[name] {
+				conflicts = append(conflicts, fmt.Sprintf("app %s imports %s from %s instead of %s", a.Alias, name, imports[name], global))
+			}
+		}
+
+		scope := a.Alias
+		if !t.Config.AppAssets.Enabled {
+			scope = a.Address
+		}
+
+		other, ok := scopes[scope]
+		if !ok {
+			scopes[scope] = a
+			continue
+		}
+
+		otherImports := t.AppImports(other)
+		for _, name := range names {
+			if otherPath, ok := otherImports[name]; ok && otherPath != imports[name] {
+				conflicts = append(conflicts, fmt.Sprintf("apps %s and %s share a scope but import %s from %s and %s", other.Alias, a.Alias, name, otherPath, imports[name]))
+			}
+		}
+	}
+
+	return conflicts
 }
 
 func (t *ImportMapTransformer) Transform(r *http.Response, doc *html.Node) error {
@@ -67,17 +257,74 @@ func (t *ImportMapTransformer) Transform(r *http.Response, doc *html.Node) error
 		return err
 	}
 
-	importMapInstance.WithMutator(t.Mutator())
+	importMapInstance.WithMutator(t.Mutator(r.Request))
 	importMapInstance.WithPreloadModules(t.Config.Importmap.PreloadModules)
 	importMapInstance.Mutate()
 
 	return nil
 }
 
-func (t *ImportMapTransformer) Mutator() ImportMapMutator {
+// VariantKey identifies the module integrity embedded in the importmap, so
+// pages get new validators once modules change.
+func (t *ImportMapTransformer) VariantKey(r *http.Request) string {
+	if t.Integrity == nil {
+		return ""
+	}
+	return "integrity-" + t.Integrity.Digest()
+}
+
+func (t *ImportMapTransformer) Mutator(r *http.Request) ImportMapMutator {
 	return func(im *ImportMap) {
-		for key, value := range t.ModuleImports {
+		snapshot := t.imports()
+
+		for key, value := range snapshot.moduleImports {
 			im.Imports[key] = t.Config.Fileserver.Prefix + value
 		}
+
+		// Integrity is only known for modules the file server serves from the
+		// module dir; app backends, canary ones included, serve their own.
+		if t.Integrity != nil {
+			if im.Integrity == nil {
+				im.Integrity = make(map[string]string)
+			}
+			for path, integrity := range t.Integrity.Modules() {
+				im.Integrity[t.Config.Fileserver.Prefix+filepath.ToSlash(path)] = integrity
+			}
+		}
+
+		variant, ok := r.Context().Value(kctx.VariantKey).(kctx.Variant)
+		if !ok {
+			variant = kctx.Variant{Name: canary.Stable}
+		}
+
+		for _, a := range t.Config.AllApps() {
+			// Same-origin apps can be imported by element name, and their
+			// modules through the element name prefix.
+			if t.Config.AppAssets.Enabled {
+				im.Imports[a.Element] = app.ScriptURL(r, t.Config, a, variant.Name)
+				im.Imports[a.Element+"/"] = app.AssetsURL(t.Config, a, variant.Name)
+			}
+
+			// Apps with their own dependencies import them within their
+			// scope, so apps may use different versions of a package.
+			if a.ModuleDir == "" {
+				continue
+			}
+			imports := snapshot.appImports[filepath.Clean(a.ModuleDir)]
+			if len(imports) == 0 {
+				continue
+			}
+
+			scope := app.ScopeURL(r, t.Config, a, variant.Name)
+			if im.Scopes == nil {
+				im.Scopes = make(map[string]map[string]string)
+			}
+			if im.Scopes[scope] == nil {
+				im.Scopes[scope] = make(map[string]string)
+			}
+			for name, importPath := range imports {
+				im.Scopes[scope][name] = t.Config.Fileserver.Prefix + importPath
+			}
+		}
 	}
 }
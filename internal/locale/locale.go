@@ -0,0 +1,177 @@
+// Copyright 2025 KDex Tech
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package locale
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"golang.org/x/text/language"
+	"gopkg.in/yaml.v3"
+	"kdex.dev/proxy/internal/config"
+	kctx "kdex.dev/proxy/internal/context"
+)
+
+// Localizer negotiates the locale of a request and looks up messages in
+// the configured catalogs. Catalogs are keyed by the text in the default
+// locale, so a missing message falls back to the text itself.
+type Localizer struct {
+	Config    *config.LocaleConfig
+	catalogs  map[string]map[string]string
+	matcher   language.Matcher
+	supported []string
+}
+
+func NewLocalizer(config *config.Config) *Localizer {
+	c := &config.Locale
+
+	supported := []string{c.Default}
+	for _, locale := range c.Supported {
+		if !slices.Contains(supported, locale) {
+			supported = append(supported, locale)
+		}
+	}
+
+	tags := make([]language.Tag, 0, len(supported))
+	for _, locale := range supported {
+		tag, err := language.Parse(locale)
+		if err != nil {
+			log.Fatalf("Invalid locale %s: %v", locale, err)
+		}
+		tags = append(tags, tag)
+	}
+
+	catalogs, err := loadCatalogs(c.CatalogDir)
+	if err != nil {
+		log.Fatalf("Invalid locale catalogs: %v", err)
+	}
+	for locale, messages := range c.Catalogs {
+		if catalogs[locale] == nil {
+			catalogs[locale] = map[string]string{}
+		}
+		for key, message := range messages {
+			catalogs[locale][key] = message
+		}
+	}
+
+	return &Localizer{
+		Config:    c,
+		catalogs:  catalogs,
+		matcher:   language.NewMatcher(tags),
+		supported: supported,
+	}
+}
+
+// Negotiate picks the locale from the path prefix, the locale cookie or the
+// Accept-Language header, in that order, and falls back to the default.
+func (l *Localizer) Negotiate(r *http.Request) string {
+	if l.Config.PathPrefix {
+		segment, _, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+		if locale, ok := l.supportedLocale(segment); ok {
+			return locale
+		}
+	}
+
+	if cookie, err := r.Cookie(l.Config.CookieName); err == nil {
+		if locale, ok := l.supportedLocale(cookie.Value); ok {
+			return locale
+		}
+	}
+
+	if header := r.Header.Get("Accept-Language"); header != "" {
+		tags, _, err := language.ParseAcceptLanguage(header)
+		if err == nil && len(tags) > 0 {
+			if _, index, confidence := l.matcher.Match(tags...); confidence != language.No {
+				return l.supported[index]
+			}
+		}
+	}
+
+	return l.supported[0]
+}
+
+// Locale returns the locale negotiated for the request.
+func (l *Localizer) Locale(r *http.Request) string {
+	if locale, ok := r.Context().Value(kctx.LocaleKey).(string); ok && locale != "" {
+		return locale
+	}
+	return l.Negotiate(r)
+}
+
+// Message returns the message for key in locale, trying the locale's base
+// language before falling back to key.
+func (l *Localizer) Message(locale string, key string) string {
+	if message, ok := l.catalogs[locale][key]; ok {
+		return message
+	}
+	if base, _, found := strings.Cut(locale, "-"); found {
+		if message, ok := l.catalogs[base][key]; ok {
+			return message
+		}
+	}
+	return key
+}
+
+// Translate implements templates.Translator.
+func (l *Localizer) Translate(r *http.Request, key string) string {
+	return l.Message(l.Locale(r), key)
+}
+
+func (l *Localizer) supportedLocale(value string) (string, bool) {
+	for _, locale := range l.supported {
+		if strings.EqualFold(locale, value) {
+			return locale, true
+		}
+	}
+	return "", false
+}
+
+func loadCatalogs(dir string) (map[string]map[string]string, error) {
+	catalogs := map[string]map[string]string{}
+	if dir == "" {
+		return catalogs, nil
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, entry := range entries {
+		ext := filepath.Ext(entry.Name())
+		if entry.IsDir() || (ext != ".yaml" && ext != ".yml" && ext != ".json") {
+			continue
+		}
+
+		data, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		messages := map[string]string{}
+		if err := yaml.Unmarshal(data, &messages); err != nil {
+			return nil, fmt.Errorf("error parsing catalog %s: %w", entry.Name(), err)
+		}
+
+		catalogs[strings.TrimSuffix(entry.Name(), ext)] = messages
+	}
+
+	return catalogs, nil
+}
@@ -0,0 +1,103 @@
+// Copyright 2025 KDex Tech
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package locale
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"kdex.dev/proxy/internal/config"
+	kctx "kdex.dev/proxy/internal/context"
+)
+
+func newTestLocalizer(t *testing.T) *Localizer {
+	dir := t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "es.yaml"), []byte("Login: Iniciar sesión\nDocs: Documentación\n"), 0644))
+
+	c := *config.DefaultConfig()
+	c.Locale = config.LocaleConfig{
+		CatalogDir: dir,
+		Catalogs: map[string]map[string]string{
+			"fr": {"Login": "Connexion", "Forbidden": "Interdit"},
+		},
+		CookieName: "kdex_locale",
+		Default:    "en",
+		PathPrefix: true,
+		Supported:  []string{"en", "fr", "es"},
+	}
+	return NewLocalizer(&c)
+}
+
+func TestLocalizer_Negotiate(t *testing.T) {
+	l := newTestLocalizer(t)
+
+	tests := []struct {
+		name           string
+		path           string
+		cookie         string
+		acceptLanguage string
+		want           string
+	}{
+		{name: "default", path: "/", want: "en"},
+		{name: "accept language", path: "/", acceptLanguage: "es-MX,es;q=0.9,en;q=0.5", want: "es"},
+		{name: "accept language weights", path: "/", acceptLanguage: "de, fr;q=0.8, en;q=0.5", want: "fr"},
+		{name: "unsupported accept language", path: "/", acceptLanguage: "de", want: "en"},
+		{name: "cookie beats header", path: "/", cookie: "fr", acceptLanguage: "es", want: "fr"},
+		{name: "unsupported cookie ignored", path: "/", cookie: "de", acceptLanguage: "es", want: "es"},
+		{name: "path prefix beats cookie", path: "/es/docs", cookie: "fr", want: "es"},
+		{name: "path without prefix", path: "/docs", cookie: "fr", want: "fr"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", tt.path, nil)
+			if tt.cookie != "" {
+				req.AddCookie(&http.Cookie{Name: "kdex_locale", Value: tt.cookie})
+			}
+			if tt.acceptLanguage != "" {
+				req.Header.Set("Accept-Language", tt.acceptLanguage)
+			}
+			assert.Equal(t, tt.want, l.Negotiate(req))
+		})
+	}
+}
+
+func TestLocalizer_Translate(t *testing.T) {
+	l := newTestLocalizer(t)
+
+	tests := []struct {
+		name   string
+		locale string
+		key    string
+		want   string
+	}{
+		{name: "inline catalog", locale: "fr", key: "Login", want: "Connexion"},
+		{name: "catalog file", locale: "es", key: "Docs", want: "Documentación"},
+		{name: "base language", locale: "fr-CA", key: "Forbidden", want: "Interdit"},
+		{name: "missing message", locale: "fr", key: "Docs", want: "Docs"},
+		{name: "default locale", locale: "en", key: "Login", want: "Login"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/", nil)
+			req = req.WithContext(context.WithValue(req.Context(), kctx.LocaleKey, tt.locale))
+			assert.Equal(t, tt.want, l.Translate(req, tt.key))
+		})
+	}
+}
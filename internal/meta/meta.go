@@ -20,19 +20,35 @@ import (
 	"golang.org/x/net/html"
 	"kdex.dev/proxy/internal/config"
 	"kdex.dev/proxy/internal/dom"
+	"kdex.dev/proxy/internal/locale"
 )
 
 type MetaTransformer struct {
-	Config *config.Config
+	Config    *config.Config
+	Localizer *locale.Localizer
 }
 
-func NewMetaTransformer(config *config.Config) *MetaTransformer {
+func NewMetaTransformer(config *config.Config, localizer *locale.Localizer) *MetaTransformer {
 	return &MetaTransformer{
-		Config: config,
+		Config:    config,
+		Localizer: localizer,
 	}
 }
 
 func (m *MetaTransformer) Transform(r *http.Response, doc *html.Node) error {
+	loginLabel, logoutLabel := m.Config.Authn.Login.Label, m.Config.Authn.Logout.Label
+	lang := ""
+
+	if m.Localizer != nil && r != nil && r.Request != nil {
+		lang = m.Localizer.Locale(r.Request)
+		loginLabel = m.Localizer.Message(lang, loginLabel)
+		logoutLabel = m.Localizer.Message(lang, logoutLabel)
+
+		if htmlNode := dom.FindElementByName("html", doc, nil); htmlNode != nil {
+			dom.SetAttribute(htmlNode, "lang", lang)
+		}
+	}
+
 	if headNode := dom.FindElementByName("head", doc, nil); headNode != nil {
 		metaNode := &html.Node{
 			Type: html.ElementNode,
@@ -42,15 +58,18 @@ func (m *MetaTransformer) Transform(r *http.Response, doc *html.Node) error {
 				{Key: "data-check-single-endpoint", Val: m.Config.Authz.Endpoints.Single},
 				{Key: "data-check-batch-endpoint", Val: m.Config.Authz.Endpoints.Batch},
 				{Key: "data-login-path", Val: m.Config.Authn.Login.Path},
-				{Key: "data-login-label", Val: m.Config.Authn.Login.Label},
+				{Key: "data-login-label", Val: loginLabel},
 				{Key: "data-login-css-query", Val: m.Config.Authn.Login.Query},
 				{Key: "data-logout-path", Val: m.Config.Authn.Logout.Path},
-				{Key: "data-logout-label", Val: m.Config.Authn.Logout.Label},
+				{Key: "data-logout-label", Val: logoutLabel},
 				{Key: "data-logout-css-query", Val: m.Config.Authn.Logout.Query},
 				{Key: "data-path-separator", Val: m.Config.Proxy.PathSeparator},
 				{Key: "data-state-endpoint", Val: m.Config.State.Endpoint},
 			},
 		}
+		if lang != "" {
+			metaNode.Attr = append(metaNode.Attr, html.Attribute{Key: "data-locale", Val: lang})
+		}
 		headNode.AppendChild(metaNode)
 	}
 
@@ -15,11 +15,17 @@
 package meta
 
 import (
+	"context"
+	"net/http"
+	"net/http/httptest"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
 	"golang.org/x/net/html"
 	"kdex.dev/proxy/internal/config"
+	kctx "kdex.dev/proxy/internal/context"
+	"kdex.dev/proxy/internal/dom"
+	"kdex.dev/proxy/internal/locale"
 	"kdex.dev/proxy/internal/store/session"
 	"kdex.dev/proxy/internal/util"
 )
@@ -79,3 +85,29 @@ func TestMetaTransformer_Transform(t *testing.T) {
 		})
 	}
 }
+
+func TestMetaTransformer_Transform_locale(t *testing.T) {
+	c := *config.DefaultConfig()
+	c.Authn.Login.Label = "Login"
+	c.Authn.Logout.Label = "Logout"
+	c.Locale.Supported = []string{"en", "fr"}
+	c.Locale.Catalogs = map[string]map[string]string{
+		"fr": {"Login": "Connexion", "Logout": "Déconnexion"},
+	}
+
+	m := NewMetaTransformer(&c, locale.NewLocalizer(&c))
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req = req.WithContext(context.WithValue(req.Context(), kctx.LocaleKey, "fr"))
+
+	doc := util.ToDoc(`<html><head></head><body></body></html>`)
+	assert.NoError(t, m.Transform(&http.Response{Request: req}, doc))
+
+	htmlNode := dom.FindElementByName("html", doc, nil)
+	assert.Equal(t, "fr", dom.GetAttribute(htmlNode, "lang"))
+
+	metaNode := dom.FindElementByName("meta", doc, nil)
+	assert.Equal(t, "Connexion", dom.GetAttribute(metaNode, "data-login-label"))
+	assert.Equal(t, "Déconnexion", dom.GetAttribute(metaNode, "data-logout-label"))
+	assert.Equal(t, "fr", dom.GetAttribute(metaNode, "data-locale"))
+}
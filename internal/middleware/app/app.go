@@ -0,0 +1,75 @@
+// Copyright 2025 KDex Tech
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package app
+
+import (
+	"log"
+	"net/http"
+
+	iapp "kdex.dev/proxy/internal/app"
+	"kdex.dev/proxy/internal/authn"
+	"kdex.dev/proxy/internal/config"
+	kctx "kdex.dev/proxy/internal/context"
+	"kdex.dev/proxy/internal/locale"
+	"kdex.dev/proxy/internal/store/session"
+)
+
+// AppMiddleware authorizes deep links into apps. Anonymous users are sent to
+// log in when OAuth is configured; everyone else is refused.
+type AppMiddleware struct {
+	Access    *iapp.Access
+	Config    *config.Config
+	Localizer *locale.Localizer
+}
+
+func (a *AppMiddleware) Authz(next http.Handler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		alias := iapp.DeepLinkAlias(r.URL.Path, a.Config.Proxy.PathSeparator)
+		if alias == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		app, ok := a.Config.GetAppByAlias(alias)
+		if !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		allowed, err := a.Access.Allowed(r, app)
+		if err != nil {
+			log.Printf("Error authorizing app %s: %v", alias, err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		if allowed {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		sessionData, _ := r.Context().Value(kctx.SessionDataKey).(*session.SessionData)
+		if sessionData == nil && a.Config.Authn.AuthValidator == authn.Validator_OAuth && a.Config.Authn.Login.Path != "" {
+			http.Redirect(w, r, a.Config.Authn.Login.Path, http.StatusTemporaryRedirect)
+			return
+		}
+
+		message := "Forbidden"
+		if a.Localizer != nil {
+			message = a.Localizer.Translate(r, message)
+		}
+		http.Error(w, message, http.StatusForbidden)
+	}
+}
@@ -0,0 +1,120 @@
+// Copyright 2025 KDex Tech
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package app
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	iapp "kdex.dev/proxy/internal/app"
+	"kdex.dev/proxy/internal/config"
+	kctx "kdex.dev/proxy/internal/context"
+	"kdex.dev/proxy/internal/store/session"
+)
+
+func TestAppMiddleware_Authz(t *testing.T) {
+	tests := []struct {
+		name         string
+		validator    string
+		path         string
+		session      *session.SessionData
+		roles        []string
+		want         int
+		wantLocation string
+	}{
+		{
+			name:  "not a deep link",
+			path:  "/posts",
+			roles: []string{"anonymous"},
+			want:  http.StatusOK,
+		},
+		{
+			name:  "unknown app",
+			path:  "/posts/_/xx/orders",
+			roles: []string{"anonymous"},
+			want:  http.StatusOK,
+		},
+		{
+			name:    "permitted",
+			path:    "/posts/_/aa/orders",
+			session: &session.SessionData{Data: map[string]interface{}{}},
+			roles:   []string{"admin"},
+			want:    http.StatusOK,
+		},
+		{
+			name:    "forbidden",
+			path:    "/posts/_/aa/orders",
+			session: &session.SessionData{Data: map[string]interface{}{}},
+			roles:   []string{"user"},
+			want:    http.StatusForbidden,
+		},
+		{
+			name:  "anonymous without login",
+			path:  "/posts/_/aa",
+			roles: []string{"anonymous"},
+			want:  http.StatusForbidden,
+		},
+		{
+			name:         "anonymous is sent to log in",
+			validator:    "oauth",
+			path:         "/posts/_/aa/orders",
+			roles:        []string{"anonymous"},
+			want:         http.StatusTemporaryRedirect,
+			wantLocation: "/~/oauth/login",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &config.Config{
+				Apps: []config.App{
+					{Address: "admin-app", Alias: "aa", Element: "admin-app", Path: "/app.js", Targets: []config.Target{{Path: "/posts"}}},
+				},
+				Authn: config.AuthnConfig{
+					AuthValidator: tt.validator,
+					Login:         config.LoginConfig{Path: "/~/oauth/login"},
+				},
+				Authz: config.AuthzConfig{
+					Provider: "static",
+					Static: config.StaticAuthzProviderConfig{
+						Permissions: []config.Permission{
+							{Action: "read", Principal: "admin", Resource: "app:aa"},
+						},
+					},
+				},
+				Proxy: config.ProxyConfig{PathSeparator: "/_/"},
+			}
+			a := &AppMiddleware{
+				Access: iapp.NewAccess(c),
+				Config: c,
+			}
+
+			ctx := context.WithValue(context.Background(), kctx.UserRolesKey, tt.roles)
+			if tt.session != nil {
+				ctx = context.WithValue(ctx, kctx.SessionDataKey, tt.session)
+			}
+			request := httptest.NewRequestWithContext(ctx, "GET", tt.path, nil)
+			recorder := httptest.NewRecorder()
+			a.Authz(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			})).ServeHTTP(recorder, request)
+
+			assert.Equal(t, tt.want, recorder.Code)
+			assert.Equal(t, tt.wantLocation, recorder.Header().Get("Location"))
+		})
+	}
+}
@@ -18,16 +18,22 @@ import (
 	"net/http"
 
 	"kdex.dev/proxy/internal/authz"
+	"kdex.dev/proxy/internal/locale"
 )
 
 type AuthzMiddleware struct {
 	Authorizer authz.Authorizer
+	Localizer  *locale.Localizer
 }
 
 func (a *AuthzMiddleware) Authz(next http.Handler) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		if err := a.Authorizer.CheckAccess(r); err != nil {
-			http.Error(w, "Forbidden", http.StatusForbidden)
+			message := "Forbidden"
+			if a.Localizer != nil {
+				message = a.Localizer.Translate(r, message)
+			}
+			http.Error(w, message, http.StatusForbidden)
 			return
 		}
 		next.ServeHTTP(w, r)
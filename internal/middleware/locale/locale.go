@@ -0,0 +1,34 @@
+// Copyright 2025 KDex Tech
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package locale
+
+import (
+	"context"
+	"net/http"
+
+	kctx "kdex.dev/proxy/internal/context"
+	"kdex.dev/proxy/internal/locale"
+)
+
+type LocaleMiddleware struct {
+	Localizer *locale.Localizer
+}
+
+func (m *LocaleMiddleware) InjectLocale(next http.Handler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := context.WithValue(r.Context(), kctx.LocaleKey, m.Localizer.Negotiate(r))
+		next.ServeHTTP(w, r.WithContext(ctx))
+	}
+}
@@ -0,0 +1,44 @@
+// Copyright 2025 KDex Tech
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package locale
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"kdex.dev/proxy/internal/config"
+	kctx "kdex.dev/proxy/internal/context"
+	"kdex.dev/proxy/internal/locale"
+)
+
+func TestLocaleMiddleware_InjectLocale(t *testing.T) {
+	c := *config.DefaultConfig()
+	c.Locale.Supported = []string{"en", "fr"}
+
+	m := &LocaleMiddleware{Localizer: locale.NewLocalizer(&c)}
+
+	var got string
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got, _ = r.Context().Value(kctx.LocaleKey).(string)
+	})
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Accept-Language", "fr-FR")
+	m.InjectLocale(next).ServeHTTP(httptest.NewRecorder(), req)
+
+	assert.Equal(t, "fr", got)
+}
@@ -0,0 +1,132 @@
+// Copyright 2025 KDex Tech
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mirror
+
+import (
+	"context"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"golang.org/x/exp/rand"
+	"kdex.dev/proxy/internal/config"
+)
+
+// Mirror sends asynchronous copies of upstream requests to a shadow address
+// and logs how the shadow responses differ from the primary ones. Shadow
+// responses are discarded.
+type Mirror struct {
+	Config *config.MirrorConfig
+	client *http.Client
+	sem    chan struct{}
+}
+
+// NewMirror returns nil when no shadow address is configured.
+func NewMirror(config *config.Config) *Mirror {
+	if config.Proxy.Mirror.Address == "" || config.Proxy.Mirror.Percentage <= 0 {
+		return nil
+	}
+
+	concurrency := config.Proxy.Mirror.MaxConcurrency
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+
+	return &Mirror{
+		Config: &config.Proxy.Mirror,
+		client: &http.Client{
+			Timeout: config.Proxy.Mirror.Timeout,
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+		sem: make(chan struct{}, concurrency),
+	}
+}
+
+// Sample reports whether the request should be mirrored.
+func (m *Mirror) Sample(r *http.Request) bool {
+	if r.ContentLength != 0 {
+		return false
+	}
+
+	methodMatch := false
+	for _, method := range m.Config.Methods {
+		if strings.EqualFold(method, r.Method) {
+			methodMatch = true
+			break
+		}
+	}
+
+	if !methodMatch {
+		return false
+	}
+
+	return rand.Float64()*100 < m.Config.Percentage
+}
+
+// Send dispatches a copy of the upstream request to the shadow address
+// without blocking. When the concurrency limit is reached the copy is
+// dropped.
+func (m *Mirror) Send(upstream *http.Request, primaryStatus int, primaryLatency time.Duration) {
+	select {
+	case m.sem <- struct{}{}:
+	default:
+		log.Printf("Mirror dropped %s %s: concurrency limit reached", upstream.Method, upstream.URL.Path)
+		return
+	}
+
+	req := upstream.Clone(context.Background())
+	req.RequestURI = ""
+	req.URL.Scheme = m.Config.Scheme
+	req.URL.Host = m.Config.Address
+	req.Host = m.Config.Address
+	req.Body = nil
+
+	if !m.Config.ForwardCredentials {
+		req.Header.Del("Authorization")
+		req.Header.Del("Cookie")
+	}
+
+	go func() {
+		defer func() { <-m.sem }()
+
+		start := time.Now()
+		resp, err := m.client.Do(req)
+		latency := time.Since(start)
+
+		if err != nil {
+			log.Printf("Mirror %s %s failed after %v: %v", req.Method, req.URL.Path, latency, err)
+			return
+		}
+
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+
+		diff := "match"
+		if resp.StatusCode != primaryStatus {
+			diff = "mismatch"
+		}
+
+		log.Printf(
+			"Mirror %s %s status %d (primary %d, %s), latency %v (primary %v, delta %v)",
+			req.Method, req.URL.Path,
+			resp.StatusCode, primaryStatus, diff,
+			latency, primaryLatency, latency-primaryLatency,
+		)
+	}()
+}
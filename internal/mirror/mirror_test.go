@@ -0,0 +1,131 @@
+// Copyright 2025 KDex Tech
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mirror
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"kdex.dev/proxy/internal/config"
+)
+
+func TestNewMirror(t *testing.T) {
+	c := *config.DefaultConfig()
+	assert.Nil(t, NewMirror(&c))
+
+	c.Proxy.Mirror.Address = "shadow:8080"
+	assert.Nil(t, NewMirror(&c))
+
+	c.Proxy.Mirror.Percentage = 10
+	assert.NotNil(t, NewMirror(&c))
+}
+
+func TestMirror_Sample(t *testing.T) {
+	tests := []struct {
+		name       string
+		percentage float64
+		method     string
+		body       string
+		want       bool
+	}{
+		{name: "all GET", percentage: 100, method: "GET", want: true},
+		{name: "POST not configured", percentage: 100, method: "POST", want: false},
+		{name: "request with body", percentage: 100, method: "GET", body: "x", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := &Mirror{
+				Config: &config.MirrorConfig{
+					Methods:    []string{"GET"},
+					Percentage: tt.percentage,
+				},
+			}
+			var r *http.Request
+			if tt.body != "" {
+				r = httptest.NewRequest(tt.method, "/", strings.NewReader(tt.body))
+			} else {
+				r = httptest.NewRequest(tt.method, "/", nil)
+			}
+			assert.Equal(t, tt.want, m.Sample(r))
+		})
+	}
+}
+
+func TestMirror_Send(t *testing.T) {
+	tests := []struct {
+		name               string
+		forwardCredentials bool
+		wantCookie         string
+		wantAuthorization  string
+	}{
+		{
+			name: "strip credentials",
+		},
+		{
+			name:               "forward credentials",
+			forwardCredentials: true,
+			wantCookie:         "session_id=abc",
+			wantAuthorization:  "Bearer token",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			received := make(chan *http.Request, 1)
+			shadow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				received <- r
+				w.WriteHeader(http.StatusNotFound)
+			}))
+			defer shadow.Close()
+
+			c := *config.DefaultConfig()
+			c.Proxy.Mirror.Address = strings.TrimPrefix(shadow.URL, "http://")
+			c.Proxy.Mirror.ForwardCredentials = tt.forwardCredentials
+			c.Proxy.Mirror.Percentage = 100
+			m := NewMirror(&c)
+
+			upstream := httptest.NewRequest("GET", "http://upstream/site/page", nil)
+			upstream.Header.Set("Cookie", "session_id=abc")
+			upstream.Header.Set("Authorization", "Bearer token")
+
+			m.Send(upstream, http.StatusOK, time.Millisecond)
+
+			select {
+			case r := <-received:
+				assert.Equal(t, "/site/page", r.URL.Path)
+				assert.Equal(t, tt.wantCookie, r.Header.Get("Cookie"))
+				assert.Equal(t, tt.wantAuthorization, r.Header.Get("Authorization"))
+			case <-time.After(time.Second * 5):
+				t.Fatal("mirror request not received")
+			}
+		})
+	}
+}
+
+func TestMirror_Send_concurrencyLimit(t *testing.T) {
+	m := &Mirror{
+		Config: &config.MirrorConfig{Address: "shadow", Scheme: "http"},
+		client: http.DefaultClient,
+		sem:    make(chan struct{}, 1),
+	}
+	m.sem <- struct{}{}
+
+	// The only slot is taken so the copy must be dropped without blocking.
+	m.Send(httptest.NewRequest("GET", "/", nil), http.StatusOK, 0)
+	assert.Len(t, m.sem, 1)
+}
@@ -16,45 +16,104 @@ package navigation
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
+	"slices"
 	"sort"
 	"strings"
-	"text/template"
 
 	"github.com/antchfx/htmlquery"
 	"golang.org/x/net/html"
+	"kdex.dev/proxy/internal/check"
 	"kdex.dev/proxy/internal/config"
+	kctx "kdex.dev/proxy/internal/context"
+	"kdex.dev/proxy/internal/locale"
+	"kdex.dev/proxy/internal/permission"
+	"kdex.dev/proxy/internal/store/session"
+	"kdex.dev/proxy/internal/templates"
 	"kdex.dev/proxy/internal/transform"
 	"kdex.dev/proxy/internal/util"
 )
 
 type NavigationTransformer struct {
 	transform.Transformer
-	Config  *config.Config
-	navTmpl *template.Template
+	Checker         *check.Checker
+	Config          *config.Config
+	Library         *templates.Library
+	Localizer       *locale.Localizer
+	Source          *Source
+	breadcrumbsTmpl *templates.Template
+	navTmpl         *templates.Template
+	treeTmpl        *templates.Template
 }
 
-func NewNavigationTransformer(config *config.Config) *NavigationTransformer {
-	tmpl := template.Must(template.New("Navigation").Parse(config.Navigation.NavItemTemplate))
-	return &NavigationTransformer{
-		Config:  config,
-		navTmpl: tmpl,
+func NewNavigationTransformer(config *config.Config, localizer *locale.Localizer) *NavigationTransformer {
+	library, err := templates.NewLibrary(config)
+	if err != nil {
+		log.Fatalf("Invalid templates: %v", err)
+	}
+
+	// A nil localizer must not become a non-nil Translator
+	if localizer != nil {
+		library.Translator = localizer
 	}
+
+	t := &NavigationTransformer{
+		Checker:   check.NewChecker(config),
+		Config:    config,
+		Library:   library,
+		Localizer: localizer,
+		Source:    NewSource(config),
+	}
+
+	for _, entry := range []struct {
+		name string
+		text string
+		tmpl **templates.Template
+	}{
+		{"Navigation", config.Navigation.NavItemTemplate, &t.navTmpl},
+		{"NavigationTree", config.Navigation.NavTemplate, &t.treeTmpl},
+		{"Breadcrumbs", config.Navigation.BreadcrumbsTemplate, &t.breadcrumbsTmpl},
+	} {
+		if entry.text == "" {
+			continue
+		}
+		if *entry.tmpl, err = library.Parse(entry.name, entry.text); err != nil {
+			log.Fatalf("Invalid navigation template: %v", err)
+		}
+	}
+
+	return t
 }
 
 func (t *NavigationTransformer) Transform(r *http.Response, doc *html.Node) error {
-	if t.Config.Navigation.NavItemsQuery == "" {
+	if t.Config.Navigation.NavItemsQuery == "" && t.Config.Navigation.ContainerQuery == "" {
 		return nil
 	}
 
-	nodes, err := htmlquery.QueryAll(doc, t.Config.Navigation.NavItemsQuery)
-	if err != nil {
-		return fmt.Errorf(`error querying navigation items: %w`, err)
+	var nodes []*html.Node
+	var err error
+
+	if t.Config.Navigation.NavItemsQuery != "" {
+		nodes, err = htmlquery.QueryAll(doc, t.Config.Navigation.NavItemsQuery)
+		if err != nil {
+			return fmt.Errorf(`error querying navigation items: %w`, err)
+		}
 	}
 
-	if len(nodes) == 0 {
+	var navNode *html.Node
+	if len(nodes) > 0 {
+		navNode = nodes[0].Parent
+	} else if t.Config.Navigation.ContainerQuery != "" {
+		navNode, err = htmlquery.Query(doc, t.Config.Navigation.ContainerQuery)
+		if err != nil {
+			return fmt.Errorf(`error querying navigation container: %w`, err)
+		}
+	}
+
+	if navNode == nil {
 		log.Printf("No navigation items found matching query: %s", t.Config.Navigation.NavItemsQuery)
 		return nil
 	}
@@ -85,36 +144,95 @@ func (t *NavigationTransformer) Transform(r *http.Response, doc *html.Node) erro
 		navItems = append(navItems, item)
 	}
 
-	// insert the template_paths from the config into the navItems
+	routeParams, _ := r.Request.Context().Value(kctx.RouteParamsKey).(map[string]string)
+
+	// insert the template_paths from the config into the navItems. Routes
+	// with parameters link to the current values and are left out when
+	// the page has none.
 	for _, templatePath := range t.Config.Navigation.TemplatePaths {
-		navItems = append(navItems, map[string]interface{}{
-			"href":   templatePath.Href,
+		href, ok := util.ExpandRoute(templatePath.Href, routeParams)
+		if !ok {
+			continue
+		}
+		item := map[string]interface{}{
+			"href":   href,
 			"label":  templatePath.Label,
 			"weight": templatePath.Weight,
-		})
+		}
+		if parent, ok := util.ExpandRoute(templatePath.Parent, routeParams); ok && parent != "" {
+			item["parent"] = parent
+		}
+		navItems = append(navItems, item)
+	}
+
+	// Without source items the page keeps the scraped and template items.
+	if t.Source != nil {
+		sourceItems, err := t.Source.Items()
+		if err != nil && !errors.Is(err, ErrNotLoaded) {
+			log.Printf("Error loading navigation items: %v", err)
+		}
+		navItems = mergeItems(navItems, sourceItems)
+	}
+
+	navItems, err = t.visible(r.Request, navItems)
+	if err != nil {
+		return err
 	}
 
 	sort.Slice(navItems, func(i, j int) bool {
 		return navItems[i]["weight"].(float64) < navItems[j]["weight"].(float64)
 	})
 
-	var output bytes.Buffer
+	if t.Localizer != nil {
+		for _, item := range navItems {
+			if label, ok := item["label"].(string); ok {
+				item["label"] = t.Localizer.Translate(r.Request, label)
+			}
+		}
+	}
 
-	for _, item := range navItems {
-		if t.Config.Proxy.AlwaysAppendSlash {
+	if t.Config.Proxy.AlwaysAppendSlash {
+		for _, item := range navItems {
 			item["href"] = strings.TrimRight(item["href"].(string), "/") + "/"
 		}
+	}
+
+	requestPath := r.Request.URL.Path
+	if p, ok := r.Request.Context().Value(kctx.RequestPathKey).(string); ok {
+		requestPath = p
+	}
+
+	tree, breadcrumbs := buildTree(navItems, requestPath)
 
-		err = t.navTmpl.Execute(&output, item)
+	var output bytes.Buffer
+
+	if t.treeTmpl != nil {
+		err = t.Library.Execute(&output, t.treeTmpl, r.Request, map[string]interface{}{
+			"breadcrumbs": breadcrumbs,
+			"items":       tree,
+			"params":      routeParams,
+			"path":        requestPath,
+		})
 		if err != nil {
-			return fmt.Errorf(`error executing navigation item template: %w`, err)
+			return fmt.Errorf(`error executing navigation template: %w`, err)
+		}
+	} else if t.navTmpl != nil {
+		for _, item := range navItems {
+			err = t.Library.Execute(&output, t.navTmpl, r.Request, item)
+			if err != nil {
+				return fmt.Errorf(`error executing navigation item template: %w`, err)
+			}
 		}
 	}
 
-	navNode := nodes[0].Parent
-
-	for _, node := range nodes {
-		navNode.RemoveChild(node)
+	if len(nodes) > 0 {
+		for _, node := range nodes {
+			navNode.RemoveChild(node)
+		}
+	} else {
+		for navNode.FirstChild != nil {
+			navNode.RemoveChild(navNode.FirstChild)
+		}
 	}
 
 	reader := bytes.NewReader(output.Bytes())
@@ -127,5 +245,137 @@ func (t *NavigationTransformer) Transform(r *http.Response, doc *html.Node) erro
 		navNode.AppendChild(node)
 	}
 
+	return t.renderBreadcrumbs(r.Request, doc, breadcrumbs, requestPath, routeParams)
+}
+
+// renderBreadcrumbs replaces the content of the breadcrumbs element with the
+// rendered trail.
+func (t *NavigationTransformer) renderBreadcrumbs(r *http.Request, doc *html.Node, breadcrumbs []map[string]interface{}, requestPath string, routeParams map[string]string) error {
+	if t.breadcrumbsTmpl == nil || t.Config.Navigation.BreadcrumbsQuery == "" {
+		return nil
+	}
+
+	container, err := htmlquery.Query(doc, t.Config.Navigation.BreadcrumbsQuery)
+	if err != nil {
+		return fmt.Errorf(`error querying breadcrumbs: %w`, err)
+	}
+	if container == nil {
+		return nil
+	}
+
+	var output bytes.Buffer
+	err = t.Library.Execute(&output, t.breadcrumbsTmpl, r, map[string]interface{}{
+		"breadcrumbs": breadcrumbs,
+		"params":      routeParams,
+		"path":        requestPath,
+	})
+	if err != nil {
+		return fmt.Errorf(`error executing breadcrumbs template: %w`, err)
+	}
+
+	newNodes, err := html.ParseFragment(&output, container)
+	if err != nil {
+		return fmt.Errorf(`error parsing breadcrumbs template: %w`, err)
+	}
+
+	for container.FirstChild != nil {
+		container.RemoveChild(container.FirstChild)
+	}
+	for _, node := range newNodes {
+		container.AppendChild(node)
+	}
+
 	return nil
 }
+
+// VariantKey identifies what the visible items depend on: whether the user
+// is authenticated, when there are protected paths, and the user's roles.
+func (t *NavigationTransformer) VariantKey(r *http.Request) string {
+	keys := []string{}
+	if len(t.Config.Navigation.ProtectedPaths) > 0 {
+		if sessionData, _ := r.Context().Value(kctx.SessionDataKey).(*session.SessionData); sessionData != nil {
+			keys = append(keys, "authenticated")
+		} else {
+			keys = append(keys, "anonymous")
+		}
+	}
+	if key := t.Checker.RolesKey(r.Context()); key != "" {
+		keys = append(keys, key)
+	}
+	return strings.Join(keys, "-")
+}
+
+// visible drops the items under ProtectedPaths for anonymous users and the
+// items whose page the user isn't permitted to read. Only local hrefs with
+// permissions defined for their page are checked; links to other sites and
+// pages without permissions are left alone.
+func (t *NavigationTransformer) visible(r *http.Request, navItems []map[string]interface{}) ([]map[string]interface{}, error) {
+	sessionData, _ := r.Context().Value(kctx.SessionDataKey).(*session.SessionData)
+	authenticated := sessionData != nil
+
+	candidates := make([]map[string]interface{}, 0, len(navItems))
+	for _, item := range navItems {
+		path, local := localPath(item)
+		if local && !authenticated && slices.ContainsFunc(t.Config.Navigation.ProtectedPaths, func(pattern string) bool {
+			return util.MatchPath(pattern, path)
+		}) {
+			continue
+		}
+		candidates = append(candidates, item)
+	}
+
+	if t.Checker == nil || t.Checker.PermissionProvider == nil {
+		return candidates, nil
+	}
+
+	tuples := []check.CheckBatchTuples{}
+	guarded := map[string]bool{}
+	for _, item := range candidates {
+		path, local := localPath(item)
+		if !local || guarded["page:"+path] {
+			continue
+		}
+		if _, err := t.Checker.PermissionProvider.GetPermissions("page:" + path); errors.Is(err, permission.ErrNoPermissions) {
+			continue
+		}
+		guarded["page:"+path] = true
+		tuples = append(tuples, check.CheckBatchTuples{Action: "read", Resource: "page:" + path})
+	}
+
+	if len(tuples) == 0 {
+		return candidates, nil
+	}
+
+	results, err := t.Checker.CheckBatch(r.Context(), tuples)
+	if err != nil && !errors.Is(err, check.ErrNoRoles) {
+		return nil, fmt.Errorf(`error checking navigation item permissions: %w`, err)
+	}
+
+	allowed := make(map[string]bool, len(results))
+	for _, result := range results {
+		allowed[result.Resource] = result.Allowed
+	}
+
+	filtered := make([]map[string]interface{}, 0, len(candidates))
+	for _, item := range candidates {
+		if path, local := localPath(item); local && guarded["page:"+path] && !allowed["page:"+path] {
+			continue
+		}
+		filtered = append(filtered, item)
+	}
+
+	return filtered, nil
+}
+
+func localPath(item map[string]interface{}) (string, bool) {
+	href, _ := item["href"].(string)
+	if !strings.HasPrefix(href, "/") || strings.HasPrefix(href, "//") {
+		return "", false
+	}
+
+	if i := strings.IndexAny(href, "?#"); i >= 0 {
+		href = href[:i]
+	}
+
+	return href, true
+}
@@ -16,33 +16,49 @@ package navigation
 
 import (
 	"bytes"
+	"context"
+	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"testing"
-	"text/template"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"golang.org/x/net/html"
+	"kdex.dev/proxy/internal/check"
 	"kdex.dev/proxy/internal/config"
+	kctx "kdex.dev/proxy/internal/context"
+	"kdex.dev/proxy/internal/locale"
+	"kdex.dev/proxy/internal/permission"
+	"kdex.dev/proxy/internal/store/session"
 	"kdex.dev/proxy/internal/util"
 )
 
 func TestNavigationTransformer_Transform(t *testing.T) {
 	type fields struct {
-		NavItemsQuery   string
-		NavItemFields   map[string]string
-		NavItemTemplate string
-		ProtectedPaths  []string
-		TemplatePaths   []config.TemplatePath
+		BreadcrumbsQuery    string
+		BreadcrumbsTemplate string
+		NavTemplate         string
+		NavItemsQuery       string
+		NavItemFields       map[string]string
+		NavItemTemplate     string
+		ProtectedPaths      []string
+		TemplatePaths       []config.TemplatePath
 	}
 	type args struct {
-		doc *html.Node
+		authenticated bool
+		doc           *html.Node
+		path          string
+		roles         []string
 	}
 	tests := []struct {
-		name     string
-		fields   fields
-		args     args
-		wantErr  bool
-		wantBody string
+		name        string
+		fields      fields
+		args        args
+		permissions []config.Permission
+		wantErr     bool
+		wantBody    string
 	}{
 		{
 			name: "transform navigation",
@@ -71,6 +87,7 @@ func TestNavigationTransformer_Transform(t *testing.T) {
 				},
 			},
 			args: args{
+				authenticated: true,
 				doc: util.ToDoc(`<nav>
 	<ul>
 		<li class="Banner-item Banner-item--title">
@@ -111,23 +128,141 @@ func TestNavigationTransformer_Transform(t *testing.T) {
 	</ul>
 </nav></body></html>`,
 		},
+		{
+			name: "protected paths hidden from anonymous users",
+			fields: fields{
+				NavItemsQuery:   `//nav//li`,
+				NavItemFields:   map[string]string{"href": `a/@href`, "label": `a/text()`},
+				NavItemTemplate: `<li><a href="{{ .href }}">{{ .label }}</a></li>`,
+				ProtectedPaths:  []string{"/private/*"},
+			},
+			args: args{
+				doc: util.ToDoc(`<nav><ul><li><a href="/about">About</a></li><li><a href="/private/area">Private</a></li></ul></nav>`),
+			},
+			wantBody: `<html><head></head><body><nav><ul><li><a href="/about">About</a></li></ul></nav></body></html>`,
+		},
+		{
+			name: "items filtered by permission",
+			fields: fields{
+				NavItemsQuery:   `//nav//li`,
+				NavItemFields:   map[string]string{"href": `a/@href`, "label": `a/text()`},
+				NavItemTemplate: `<li><a href="{{ .href }}">{{ .label }}</a></li>`,
+				TemplatePaths: []config.TemplatePath{
+					{Href: "/admin", Label: "Admin", Weight: 5},
+				},
+			},
+			args: args{
+				doc:   util.ToDoc(`<nav><ul><li><a href="/about?x=1">About</a></li><li><a href="https://example.com/">External</a></li></ul></nav>`),
+				roles: []string{"user"},
+			},
+			permissions: []config.Permission{
+				{Resource: "page:/about", Action: "read", Principal: "user"},
+				{Resource: "page:/admin", Action: "read", Principal: "admin"},
+			},
+			wantBody: `<html><head></head><body><nav><ul><li><a href="/about?x=1">About</a></li><li><a href="https://example.com/">External</a></li></ul></nav></body></html>`,
+		},
+		{
+			name: "admin sees admin item",
+			fields: fields{
+				NavItemsQuery:   `//nav//li`,
+				NavItemFields:   map[string]string{"href": `a/@href`, "label": `a/text()`},
+				NavItemTemplate: `<li><a href="{{ .href }}">{{ .label }}</a></li>`,
+				TemplatePaths: []config.TemplatePath{
+					{Href: "/admin", Label: "Admin", Weight: 5},
+				},
+			},
+			args: args{
+				doc:   util.ToDoc(`<nav><ul><li><a href="/about">About</a></li></ul></nav>`),
+				roles: []string{"admin"},
+			},
+			permissions: []config.Permission{
+				{Resource: "page:/about", Action: "read", Principal: "*"},
+				{Resource: "page:/admin", Action: "read", Principal: "admin"},
+			},
+			wantBody: `<html><head></head><body><nav><ul><li><a href="/about">About</a></li><li><a href="/admin">Admin</a></li></ul></nav></body></html>`,
+		},
+		{
+			name: "nested tree with active item and breadcrumbs",
+			fields: fields{
+				BreadcrumbsQuery:    `//ol[@class='breadcrumbs']`,
+				BreadcrumbsTemplate: `{{ range .breadcrumbs }}<li><a href="{{ .href }}">{{ .label }}</a></li>{{ end }}`,
+				NavItemsQuery:       `//nav//li`,
+				NavItemFields:       map[string]string{"href": `a/@href`, "label": `a/text()`},
+				NavTemplate:         `{{ define "items" }}{{ range . }}<li{{ if .active }} aria-current="page"{{ else if .ancestor }} class="ancestor"{{ end }}><a href="{{ .href }}">{{ .label }}</a>{{ if .children }}<ul>{{ template "items" .children }}</ul>{{ end }}</li>{{ end }}{{ end }}{{ template "items" .items }}`,
+				TemplatePaths: []config.TemplatePath{
+					{Href: "/docs/guides/install", Label: "Install", Weight: 10},
+					{Href: "/changelog", Label: "Changelog", Parent: "/docs", Weight: 11},
+				},
+			},
+			args: args{
+				doc:  util.ToDoc(`<nav><ul><li><a href="/">Home</a></li><li><a href="/docs">Docs</a></li><li><a href="/docs/guides">Guides</a></li></ul></nav><ol class="breadcrumbs"><li>placeholder</li></ol>`),
+				path: "/docs/guides/install",
+			},
+			wantBody: `<html><head></head><body><nav><ul><li><a href="/">Home</a></li><li class="ancestor"><a href="/docs">Docs</a><ul><li class="ancestor"><a href="/docs/guides">Guides</a><ul><li aria-current="page"><a href="/docs/guides/install">Install</a></li></ul></li><li><a href="/changelog">Changelog</a></li></ul></li></ul></nav><ol class="breadcrumbs"><li><a href="/docs">Docs</a></li><li><a href="/docs/guides">Guides</a></li><li><a href="/docs/guides/install">Install</a></li></ol></body></html>`,
+		},
+		{
+			name: "ancestor of a page outside the navigation",
+			fields: fields{
+				BreadcrumbsQuery:    `//ol`,
+				BreadcrumbsTemplate: `{{ range .breadcrumbs }}<li>{{ .label }}</li>{{ end }}`,
+				NavItemsQuery:       `//nav//li`,
+				NavItemFields:       map[string]string{"href": `a/@href`, "label": `a/text()`},
+				NavItemTemplate:     `<li{{ if .ancestor }} class="ancestor"{{ end }}><a href="{{ .href }}">{{ .label }}</a></li>`,
+			},
+			args: args{
+				doc:  util.ToDoc(`<nav><ul><li><a href="/blog">Blog</a></li><li><a href="/about">About</a></li></ul></nav><ol></ol>`),
+				path: "/blog/2025/hello",
+			},
+			wantBody: `<html><head></head><body><nav><ul><li class="ancestor"><a href="/blog">Blog</a></li><li><a href="/about">About</a></li></ul></nav><ol><li>Blog</li></ol></body></html>`,
+		},
+		{
+			name: "labels are escaped",
+			fields: fields{
+				NavItemsQuery:   `//nav//li`,
+				NavItemFields:   map[string]string{"href": `a/@href`, "label": `a/text()`},
+				NavItemTemplate: `<li><a href="{{ .href }}">{{ .label }}</a></li>`,
+			},
+			args: args{
+				doc: util.ToDoc(`<nav><ul><li><a href="javascript:alert(1)">&lt;script&gt;alert(1)&lt;/script&gt;</a></li></ul></nav>`),
+			},
+			wantBody: `<html><head></head><body><nav><ul><li><a href="#ZgotmplZ">&lt;script&gt;alert(1)&lt;/script&gt;</a></li></ul></nav></body></html>`,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			defaultConfig := config.DefaultConfig()
-			defaultConfig.Navigation.NavItemsQuery = tt.fields.NavItemsQuery
-			defaultConfig.Navigation.NavItemFields = tt.fields.NavItemFields
-			defaultConfig.Navigation.ProtectedPaths = tt.fields.ProtectedPaths
-			defaultConfig.Navigation.TemplatePaths = tt.fields.TemplatePaths
-
-			tr := &NavigationTransformer{
-				Config:  defaultConfig,
-				navTmpl: template.Must(template.New("Navigation").Parse(tt.fields.NavItemTemplate)),
+			c := *config.DefaultConfig()
+			c.Navigation.BreadcrumbsQuery = tt.fields.BreadcrumbsQuery
+			c.Navigation.BreadcrumbsTemplate = tt.fields.BreadcrumbsTemplate
+			c.Navigation.NavItemsQuery = tt.fields.NavItemsQuery
+			c.Navigation.NavItemFields = tt.fields.NavItemFields
+			c.Navigation.NavItemTemplate = tt.fields.NavItemTemplate
+			c.Navigation.NavTemplate = tt.fields.NavTemplate
+			c.Navigation.ProtectedPaths = tt.fields.ProtectedPaths
+			c.Navigation.TemplatePaths = tt.fields.TemplatePaths
+
+			tr := NewNavigationTransformer(&c, locale.NewLocalizer(&c))
+			tr.Checker = nil
+			if tt.permissions != nil {
+				tr.Checker = &check.Checker{
+					PermissionProvider: &permission.StaticPermissionProvider{Permissions: tt.permissions},
+				}
+			}
+
+			path := tt.args.path
+			if path == "" {
+				path = "/"
+			}
+			req := httptest.NewRequest("GET", path, nil)
+			if tt.args.authenticated {
+				req = req.WithContext(context.WithValue(req.Context(), kctx.SessionDataKey, &session.SessionData{}))
+			}
+			if tt.args.roles != nil {
+				req = req.WithContext(context.WithValue(req.Context(), kctx.UserRolesKey, tt.args.roles))
 			}
 
 			rec := httptest.NewRecorder()
 			res := rec.Result()
-			res.Request = httptest.NewRequest("GET", "/", nil)
+			res.Request = req
 			if err := tr.Transform(res, tt.args.doc); (err != nil) != tt.wantErr {
 				t.Errorf("NavigationTransformer.Transform() error = %v, wantErr %v", err, tt.wantErr)
 			}
@@ -137,3 +272,289 @@ func TestNavigationTransformer_Transform(t *testing.T) {
 		})
 	}
 }
+
+func TestSource_Items(t *testing.T) {
+	t.Run("file", func(t *testing.T) {
+		file := filepath.Join(t.TempDir(), "nav.yaml")
+		assert.NoError(t, os.WriteFile(file, []byte("items:\n  - href: /docs\n    label: Docs\n    weight: 2\n  - href: /blog\n    label: Blog\n"), 0644))
+
+		source := &Source{Config: &config.NavigationSource{File: file, Refresh: time.Hour}}
+		items, err := source.Items()
+		assert.NoError(t, err)
+		assert.Equal(t, []map[string]interface{}{
+			{"href": "/docs", "label": "Docs", "weight": float64(2)},
+			{"href": "/blog", "label": "Blog", "weight": float64(1)},
+		}, items)
+
+		// Cached until the refresh interval passes
+		assert.NoError(t, os.WriteFile(file, []byte(`[{"href": "/new", "label": "New"}]`), 0644))
+		items, err = source.Items()
+		assert.NoError(t, err)
+		assert.Len(t, items, 2)
+
+		// Stale items are served while they are reloaded in the background
+		source.mu.Lock()
+		source.loadedAt = time.Time{}
+		source.mu.Unlock()
+		items, err = source.Items()
+		assert.NoError(t, err)
+		assert.Len(t, items, 2)
+		assert.Eventually(t, func() bool {
+			items, _ := source.Items()
+			return len(items) == 1
+		}, time.Second, 10*time.Millisecond)
+
+		// Previous items survive a failed reload
+		assert.NoError(t, os.WriteFile(file, []byte(`{"items": "nope"}`), 0644))
+		source.mu.Lock()
+		source.loadedAt = time.Time{}
+		source.mu.Unlock()
+		source.Items()
+		assert.Eventually(t, func() bool {
+			source.mu.Lock()
+			defer source.mu.Unlock()
+			return !source.refreshing && !source.loadedAt.IsZero()
+		}, time.Second, 10*time.Millisecond)
+		items, err = source.Items()
+		assert.NoError(t, err)
+		assert.Equal(t, []map[string]interface{}{{"href": "/new", "label": "New", "weight": float64(0)}}, items)
+	})
+
+	t.Run("endpoint", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`[{"href": "/docs", "label": "Docs", "parent": "/"}]`))
+		}))
+		defer server.Close()
+
+		c := *config.DefaultConfig()
+		c.Navigation.Source = config.NavigationSource{URL: server.URL, Refresh: time.Hour, Timeout: time.Second}
+
+		items, err := NewSource(&c).Items()
+		assert.NoError(t, err)
+		assert.Equal(t, []map[string]interface{}{{"href": "/docs", "label": "Docs", "parent": "/", "weight": float64(0)}}, items)
+	})
+
+	t.Run("slow endpoint", func(t *testing.T) {
+		release := make(chan struct{})
+		calls := 0
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			calls++
+			if calls > 1 {
+				<-release
+			}
+			w.Write([]byte(`[{"href": "/docs", "label": "Docs"}]`))
+		}))
+		defer server.Close()
+		defer close(release)
+
+		c := *config.DefaultConfig()
+		c.Navigation.Source = config.NavigationSource{URL: server.URL, Refresh: time.Hour, Timeout: 5 * time.Second}
+		source := NewSource(&c)
+
+		_, err := source.Items()
+		assert.NoError(t, err)
+
+		// A slow reload doesn't hold up the requests
+		source.mu.Lock()
+		source.loadedAt = time.Time{}
+		source.mu.Unlock()
+
+		done := make(chan struct{})
+		go func() {
+			for i := 0; i < 3; i++ {
+				items, err := source.Items()
+				assert.NoError(t, err)
+				assert.Len(t, items, 1)
+			}
+			close(done)
+		}()
+
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Fatal("requests waited for the reload")
+		}
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		file := filepath.Join(t.TempDir(), "nav.yaml")
+		source := &Source{Config: &config.NavigationSource{File: file, Refresh: time.Hour}}
+		_, err := source.Items()
+		assert.Error(t, err)
+		assert.NotErrorIs(t, err, ErrNotLoaded)
+
+		// The failed first load is backed off from
+		assert.NoError(t, os.WriteFile(file, []byte(`[{"href": "/docs", "label": "Docs"}]`), 0644))
+		_, err = source.Items()
+		assert.ErrorIs(t, err, ErrNotLoaded)
+
+		source.mu.Lock()
+		assert.Equal(t, time.Second, source.retryDelay())
+		source.retryAt = time.Time{}
+		source.mu.Unlock()
+		items, err := source.Items()
+		assert.NoError(t, err)
+		assert.Len(t, items, 1)
+	})
+}
+
+func TestNavigationTransformer_Transform_source(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "nav.json")
+	assert.NoError(t, os.WriteFile(file, []byte(`[{"href": "/about", "label": "About Us", "weight": 5}, {"href": "/docs", "label": "Docs", "weight": 0.5}]`), 0644))
+
+	c := *config.DefaultConfig()
+	c.Authz.Provider = ""
+	c.Navigation = config.NavigationConfig{
+		ContainerQuery:  `//nav/ul`,
+		NavItemsQuery:   `//nav//li`,
+		NavItemFields:   map[string]string{"href": `a/@href`, "label": `a/text()`},
+		NavItemTemplate: `<li><a href="{{ .href }}">{{ .label }}</a></li>`,
+		Source:          config.NavigationSource{File: file, Refresh: time.Hour},
+	}
+
+	tests := []struct {
+		name string
+		doc  string
+		want string
+	}{
+		{
+			name: "empty placeholder",
+			doc:  `<nav><ul></ul></nav>`,
+			want: `<html><head></head><body><nav><ul><li><a href="/docs">Docs</a></li><li><a href="/about">About Us</a></li></ul></nav></body></html>`,
+		},
+		{
+			name: "merged with scraped items by href",
+			doc:  `<nav><ul><li><a href="/about">About</a></li><li><a href="/blog">Blog</a></li></ul></nav>`,
+			want: `<html><head></head><body><nav><ul><li><a href="/docs">Docs</a></li><li><a href="/blog">Blog</a></li><li><a href="/about">About Us</a></li></ul></nav></body></html>`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tr := NewNavigationTransformer(&c, locale.NewLocalizer(&c))
+
+			res := httptest.NewRecorder().Result()
+			res.Request = httptest.NewRequest("GET", "/", nil)
+
+			doc := util.ToDoc(tt.doc)
+			assert.NoError(t, tr.Transform(res, doc))
+			assert.Equal(t, tt.want, util.FromDoc(doc))
+		})
+	}
+}
+
+func TestNavigationTransformer_Transform_sourceUnavailable(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	c := *config.DefaultConfig()
+	c.Authz.Provider = ""
+	c.Navigation = config.NavigationConfig{
+		NavItemsQuery:   `//nav//li`,
+		NavItemFields:   map[string]string{"href": `a/@href`, "label": `a/text()`},
+		NavItemTemplate: `<li><a href="{{ .href }}">{{ .label }}</a></li>`,
+		Source:          config.NavigationSource{URL: server.URL, Refresh: time.Hour, Timeout: time.Second},
+		TemplatePaths:   []config.TemplatePath{{Href: "/blog", Label: "Blog", Weight: 5}},
+	}
+	tr := NewNavigationTransformer(&c, locale.NewLocalizer(&c))
+
+	for i := 0; i < 2; i++ {
+		res := httptest.NewRecorder().Result()
+		res.Request = httptest.NewRequest("GET", "/", nil)
+
+		doc := util.ToDoc(`<nav><ul><li><a href="/">Home</a></li></ul></nav>`)
+		assert.NoError(t, tr.Transform(res, doc))
+		assert.Equal(t, `<html><head></head><body><nav><ul><li><a href="/">Home</a></li><li><a href="/blog">Blog</a></li></ul></nav></body></html>`, util.FromDoc(doc))
+	}
+}
+
+func TestNavigationTransformer_Transform_defaultAuthz(t *testing.T) {
+	c := *config.DefaultConfig()
+	c.Navigation.NavItemsQuery = `//nav//li`
+	c.Navigation.NavItemFields = map[string]string{"href": `a/@href`, "label": `a/text()`}
+	c.Navigation.NavItemTemplate = `<li><a href="{{ .href }}">{{ .label }}</a></li>`
+
+	transform := func(roles []string) string {
+		tr := NewNavigationTransformer(&c, locale.NewLocalizer(&c))
+		req := httptest.NewRequest("GET", "/", nil)
+		res := httptest.NewRecorder().Result()
+		res.Request = req.WithContext(context.WithValue(req.Context(), kctx.UserRolesKey, roles))
+
+		doc := util.ToDoc(`<nav><ul><li><a href="/">Home</a></li><li><a href="/admin">Admin</a></li></ul></nav>`)
+		assert.NoError(t, tr.Transform(res, doc))
+		return util.FromDoc(doc)
+	}
+
+	assert.Equal(t, `<html><head></head><body><nav><ul><li><a href="/">Home</a></li><li><a href="/admin">Admin</a></li></ul></nav></body></html>`, transform([]string{"anonymous"}), "pages without permissions are visible")
+
+	c.Authz.Static.Permissions = []config.Permission{{Action: "read", Principal: "admin", Resource: "page:/admin"}}
+	assert.Equal(t, `<html><head></head><body><nav><ul><li><a href="/">Home</a></li></ul></nav></body></html>`, transform([]string{"anonymous"}))
+	assert.Equal(t, `<html><head></head><body><nav><ul><li><a href="/">Home</a></li></ul></nav></body></html>`, transform(nil), "users without roles can't see guarded pages")
+	assert.Equal(t, `<html><head></head><body><nav><ul><li><a href="/">Home</a></li><li><a href="/admin">Admin</a></li></ul></nav></body></html>`, transform([]string{"admin"}))
+}
+
+func TestNavigationTransformer_Transform_nilLocalizer(t *testing.T) {
+	c := *config.DefaultConfig()
+	c.Authz.Provider = ""
+	c.Navigation = config.NavigationConfig{
+		ContainerQuery: `//nav/ul`,
+		NavTemplate:    `{{ range .items }}<li><a href="{{ .href }}">{{ t .label }}</a></li>{{ end }}`,
+		TemplatePaths:  []config.TemplatePath{{Href: "/blog", Label: "nav.blog", Weight: 1}},
+	}
+	tr := NewNavigationTransformer(&c, nil)
+
+	res := httptest.NewRecorder().Result()
+	res.Request = httptest.NewRequest("GET", "/", nil)
+
+	doc := util.ToDoc(`<nav><ul></ul></nav>`)
+	assert.NoError(t, tr.Transform(res, doc))
+	assert.Equal(t, `<html><head></head><body><nav><ul><li><a href="/blog">nav.blog</a></li></ul></nav></body></html>`, util.FromDoc(doc))
+}
+
+func TestNavigationTransformer_Transform_routeParams(t *testing.T) {
+	c := *config.DefaultConfig()
+	c.Authz.Provider = ""
+	c.Navigation = config.NavigationConfig{
+		ContainerQuery: `//nav/ul`,
+		NavTemplate:    `{{ range .items }}<li><a href="{{ .href }}">{{ .label }}</a></li>{{ end }}<li>{{ .params.id }}/{{ routeParam "id" }}</li>`,
+		TemplatePaths: []config.TemplatePath{
+			{Href: "/products/{id}", Label: "Product", Template: "/product", Weight: 1},
+			{Href: "/products/{id}/reviews", Label: "Reviews", Parent: "/products/{id}", Template: "/product-reviews", Weight: 2},
+			{Href: "/shops/{shop}", Label: "Shop", Template: "/shop", Weight: 3},
+		},
+	}
+
+	tr := NewNavigationTransformer(&c, locale.NewLocalizer(&c))
+
+	request := httptest.NewRequest("GET", "/products/42/reviews", nil)
+	request = request.WithContext(context.WithValue(request.Context(), kctx.RouteParamsKey, map[string]string{"id": "42"}))
+	res := httptest.NewRecorder().Result()
+	res.Request = request
+
+	doc := util.ToDoc(`<nav><ul></ul></nav>`)
+	assert.NoError(t, tr.Transform(res, doc))
+	assert.Equal(t, `<html><head></head><body><nav><ul><li><a href="/products/42">Product</a></li><li>42/42</li></ul></nav></body></html>`, util.FromDoc(doc))
+}
+
+func TestNavigationTransformer_VariantKey(t *testing.T) {
+	tr := &NavigationTransformer{Config: &config.Config{}}
+
+	request := func(authenticated bool, roles ...string) *http.Request {
+		req := httptest.NewRequest("GET", "/", nil)
+		if authenticated {
+			req = req.WithContext(context.WithValue(req.Context(), kctx.SessionDataKey, &session.SessionData{}))
+		}
+		return req.WithContext(context.WithValue(req.Context(), kctx.UserRolesKey, roles))
+	}
+
+	assert.Empty(t, tr.VariantKey(request(true, "user")))
+
+	tr.Config.Navigation.ProtectedPaths = []string{"/admin*"}
+	assert.NotEqual(t, tr.VariantKey(request(false)), tr.VariantKey(request(true)))
+
+	tr.Checker = &check.Checker{PermissionProvider: &permission.StaticPermissionProvider{}}
+	assert.NotEqual(t, tr.VariantKey(request(true, "user")), tr.VariantKey(request(true, "admin")))
+	assert.Equal(t, tr.VariantKey(request(true, "admin", "user")), tr.VariantKey(request(true, "user", "admin")))
+}
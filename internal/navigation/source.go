@@ -0,0 +1,267 @@
+// Copyright 2025 KDex Tech
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package navigation
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"maps"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v3"
+	"kdex.dev/proxy/internal/config"
+)
+
+// ErrNotLoaded is returned while the first load is retried after failing.
+var ErrNotLoaded = errors.New("navigation items not loaded yet")
+
+// maxRetryDelay bounds the back off between failed first loads.
+const maxRetryDelay = time.Minute
+
+// Source loads nav items from a YAML or JSON file or endpoint. The document
+// is either a list of items or an object with an "items" list; each item has
+// at least an href and a label. Loaded items are served while they are
+// reloaded in the background once the refresh interval passes, and the last
+// good items keep being served when a reload fails. Only the first load is
+// waited for; when it fails it is retried with a growing delay rather than
+// on every request.
+type Source struct {
+	Config     *config.NavigationSource
+	client     *http.Client
+	failures   int
+	first      sync.Mutex // Held while the first items are loaded
+	items      []map[string]interface{}
+	loadedAt   time.Time
+	mu         sync.Mutex
+	refreshing bool
+	retryAt    time.Time
+}
+
+func NewSource(config *config.Config) *Source {
+	if config.Navigation.Source.File == "" && config.Navigation.Source.URL == "" {
+		return nil
+	}
+
+	return &Source{
+		Config: &config.Navigation.Source,
+		client: &http.Client{Timeout: config.Navigation.Source.Timeout},
+	}
+}
+
+// Items returns a copy of the current items, reloading them when stale.
+func (s *Source) Items() ([]map[string]interface{}, error) {
+	s.mu.Lock()
+	items := s.items
+	stale := items != nil && time.Since(s.loadedAt) >= s.Config.Refresh && !s.refreshing
+	if stale {
+		s.refreshing = true
+	}
+	s.mu.Unlock()
+
+	if stale {
+		go func() {
+			if _, err := s.refresh(); err != nil {
+				log.Printf("Keeping previous navigation items: %v", err)
+			}
+		}()
+	}
+
+	if items == nil {
+		var err error
+		if items, err = s.firstItems(); err != nil {
+			return nil, err
+		}
+	}
+
+	copies := make([]map[string]interface{}, 0, len(items))
+	for _, item := range items {
+		copies = append(copies, maps.Clone(item))
+	}
+	return copies, nil
+}
+
+// firstItems loads the items unless a concurrent request did meanwhile, or
+// a failed load is being backed off from.
+func (s *Source) firstItems() ([]map[string]interface{}, error) {
+	s.mu.Lock()
+	backingOff := time.Now().Before(s.retryAt)
+	s.mu.Unlock()
+	if backingOff {
+		return nil, ErrNotLoaded
+	}
+
+	s.first.Lock()
+	defer s.first.Unlock()
+
+	s.mu.Lock()
+	items := s.items
+	backingOff = time.Now().Before(s.retryAt)
+	s.mu.Unlock()
+
+	if items != nil {
+		return items, nil
+	}
+	if backingOff {
+		return nil, ErrNotLoaded
+	}
+
+	items, err := s.refresh()
+	if err != nil {
+		s.mu.Lock()
+		s.failures++
+		s.retryAt = time.Now().Add(s.retryDelay())
+		s.mu.Unlock()
+	}
+	return items, err
+}
+
+// retryDelay doubles from a second with every failed first load.
+func (s *Source) retryDelay() time.Duration {
+	delay := maxRetryDelay
+	if s.failures <= 6 {
+		delay = time.Second << (s.failures - 1)
+	}
+	return min(delay, maxRetryDelay)
+}
+
+// refresh loads the items independently of any request, so a canceled
+// request can't fail the load for the others.
+func (s *Source) refresh() ([]map[string]interface{}, error) {
+	ctx := context.Background()
+	if s.Config.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.Config.Timeout)
+		defer cancel()
+	}
+
+	items, err := s.load(ctx)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.loadedAt = time.Now()
+	s.refreshing = false
+	if err != nil {
+		return nil, err
+	}
+	s.items = items
+	return items, nil
+}
+
+func (s *Source) load(ctx context.Context) ([]map[string]interface{}, error) {
+	var data []byte
+	var err error
+
+	if s.Config.File != "" {
+		data, err = os.ReadFile(s.Config.File)
+		if err != nil {
+			return nil, fmt.Errorf("error reading navigation file: %w", err)
+		}
+	} else {
+		data, err = s.fetch(ctx)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return parseItems(data)
+}
+
+func (s *Source) fetch(ctx context.Context) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.Config.URL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error creating navigation request: %w", err)
+	}
+	req.Header.Set("Accept", "application/json, application/yaml")
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching navigation: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("error fetching navigation: %s", resp.Status)
+	}
+
+	return io.ReadAll(resp.Body)
+}
+
+// parseItems accepts YAML and, being a superset of it, JSON.
+func parseItems(data []byte) ([]map[string]interface{}, error) {
+	var document interface{}
+	if err := yaml.Unmarshal(data, &document); err != nil {
+		return nil, fmt.Errorf("error parsing navigation: %w", err)
+	}
+
+	if object, ok := document.(map[string]interface{}); ok {
+		document = object["items"]
+	}
+
+	list, ok := document.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("error parsing navigation: expected a list of items")
+	}
+
+	items := make([]map[string]interface{}, 0, len(list))
+	for index, entry := range list {
+		item, ok := entry.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("error parsing navigation: item %d is not an object", index)
+		}
+		if _, ok := item["href"].(string); !ok {
+			return nil, fmt.Errorf("error parsing navigation: item %d has no href", index)
+		}
+
+		switch weight := item["weight"].(type) {
+		case int:
+			item["weight"] = float64(weight)
+		case float64:
+		default:
+			item["weight"] = float64(index)
+		}
+
+		items = append(items, item)
+	}
+
+	return items, nil
+}
+
+// mergeItems overlays the source items onto the scraped ones sharing their
+// href and appends the rest.
+func mergeItems(navItems []map[string]interface{}, sourceItems []map[string]interface{}) []map[string]interface{} {
+	byHref := make(map[string]map[string]interface{}, len(navItems))
+	for _, item := range navItems {
+		if href, ok := item["href"].(string); ok {
+			byHref[href] = item
+		}
+	}
+
+	for _, item := range sourceItems {
+		if existing, ok := byHref[item["href"].(string)]; ok {
+			maps.Copy(existing, item)
+			continue
+		}
+		navItems = append(navItems, item)
+	}
+
+	return navItems
+}
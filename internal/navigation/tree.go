@@ -0,0 +1,148 @@
+// Copyright 2025 KDex Tech
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package navigation
+
+import (
+	"sort"
+	"strings"
+)
+
+// buildTree nests the items under their parents and flags the active item
+// and its ancestors for the request path. An item's parent is the item whose
+// href matches its "parent" field or, failing that, the item with the
+// longest href enclosing its own. The returned breadcrumbs run from the
+// outermost ancestor to the active item.
+func buildTree(navItems []map[string]interface{}, requestPath string) ([]map[string]interface{}, []map[string]interface{}) {
+	byPath := make(map[string]int, len(navItems))
+	for i, item := range navItems {
+		item["active"] = false
+		item["ancestor"] = false
+		item["children"] = []map[string]interface{}{}
+		if path, ok := localPath(item); ok {
+			if _, exists := byPath[normalizePath(path)]; !exists {
+				byPath[normalizePath(path)] = i
+			}
+		}
+	}
+
+	parents := make([]int, len(navItems))
+	roots := []map[string]interface{}{}
+
+	for i, item := range navItems {
+		parents[i] = findParent(i, item, byPath)
+		if parents[i] < 0 {
+			roots = append(roots, item)
+			continue
+		}
+		parent := navItems[parents[i]]
+		parent["children"] = append(parent["children"].([]map[string]interface{}), item)
+	}
+
+	current := -1
+	for i, item := range navItems {
+		if path, ok := localPath(item); ok && normalizePath(path) == normalizePath(requestPath) {
+			item["active"] = true
+			current = i
+			break
+		}
+	}
+	if current < 0 {
+		current = deepestEnclosing(navItems, requestPath)
+	}
+
+	breadcrumbs := []map[string]interface{}{}
+	seen := map[int]bool{}
+	for i := current; i >= 0 && !seen[i]; i = parents[i] {
+		seen[i] = true
+		if !navItems[i]["active"].(bool) {
+			navItems[i]["ancestor"] = true
+		}
+		breadcrumbs = append([]map[string]interface{}{navItems[i]}, breadcrumbs...)
+	}
+
+	setDepth(roots, 0)
+
+	return roots, breadcrumbs
+}
+
+func findParent(index int, item map[string]interface{}, byPath map[string]int) int {
+	if parentHref, ok := item["parent"].(string); ok && parentHref != "" {
+		if parent, ok := byPath[normalizePath(parentHref)]; ok && parent != index {
+			return parent
+		}
+		return -1
+	}
+
+	path, ok := localPath(item)
+	if !ok {
+		return -1
+	}
+
+	// The root path would enclose everything, so it never becomes a parent
+	// implicitly.
+	for path = normalizePath(path); path != "/"; {
+		path = normalizePath(path[:strings.LastIndex(path, "/")])
+		if path == "/" {
+			break
+		}
+		if parent, ok := byPath[path]; ok && parent != index {
+			return parent
+		}
+	}
+
+	return -1
+}
+
+// deepestEnclosing returns the index of the item with the longest href that
+// encloses the request path, or -1.
+func deepestEnclosing(navItems []map[string]interface{}, requestPath string) int {
+	requestPath = normalizePath(requestPath)
+	best, bestLen := -1, 0
+
+	for i, item := range navItems {
+		path, ok := localPath(item)
+		if !ok {
+			continue
+		}
+		path = normalizePath(path)
+		if path == "/" || !strings.HasPrefix(requestPath, path+"/") {
+			continue
+		}
+		if len(path) > bestLen {
+			best, bestLen = i, len(path)
+		}
+	}
+
+	return best
+}
+
+func setDepth(items []map[string]interface{}, depth int) {
+	sort.SliceStable(items, func(i, j int) bool {
+		return items[i]["weight"].(float64) < items[j]["weight"].(float64)
+	})
+
+	for _, item := range items {
+		item["depth"] = depth
+		setDepth(item["children"].([]map[string]interface{}), depth+1)
+	}
+}
+
+func normalizePath(path string) string {
+	path = strings.TrimRight(path, "/")
+	if path == "" {
+		return "/"
+	}
+	return path
+}
@@ -17,7 +17,9 @@ package proxy
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
+	"hash/crc32"
 	"io"
 	"log"
 	"net"
@@ -30,11 +32,20 @@ import (
 
 	"golang.org/x/net/html"
 	"kdex.dev/proxy/internal/app"
+	"kdex.dev/proxy/internal/canary"
 	"kdex.dev/proxy/internal/config"
 	kctx "kdex.dev/proxy/internal/context"
+	"kdex.dev/proxy/internal/headers"
 	"kdex.dev/proxy/internal/importmap"
+	"kdex.dev/proxy/internal/locale"
 	"kdex.dev/proxy/internal/meta"
+	"kdex.dev/proxy/internal/mirror"
 	"kdex.dev/proxy/internal/navigation"
+	"kdex.dev/proxy/internal/prune"
+	"kdex.dev/proxy/internal/rewrite"
+	"kdex.dev/proxy/internal/rules"
+	"kdex.dev/proxy/internal/scanner"
+	"kdex.dev/proxy/internal/state"
 	"kdex.dev/proxy/internal/store/cache"
 	"kdex.dev/proxy/internal/transform"
 	"kdex.dev/proxy/internal/util"
@@ -43,17 +54,30 @@ import (
 type Proxy struct {
 	Config      *config.Config
 	cache       *cache.CacheStore
+	canary      *canary.Router
+	headers     *headers.HeaderModifier
+	mirror      *mirror.Mirror
+	rewriter    *rewrite.Rewriter
 	transformer transform.Transformer
 }
 
-func NewProxy(config *config.Config) *Proxy {
+// Components are shared by the proxy's transformers and the rest of the
+// engine, so each is created once.
+type Components struct {
+	Health    *app.Health
+	Integrity *scanner.Integrity
+	Localizer *locale.Localizer
+}
+
+func NewProxy(config *config.Config, components Components) *Proxy {
+	if !transform.ValidOnError(config.Transform.OnError) {
+		log.Fatalf("Invalid transform on_error: %s", config.Transform.OnError)
+	}
+
 	transformer := &transform.AggregatedTransformer{
-		Transformers: []transform.Transformer{
-			importmap.NewImportMapTransformer(config),
-			meta.NewMetaTransformer(config),
-			navigation.NewNavigationTransformer(config),
-			app.NewAppTransformer(config),
-		},
+		OnError:      config.Transform.OnError,
+		Timeout:      config.Transform.Timeout,
+		Transformers: NewTransformers(config, components),
 	}
 
 	cache := cache.NewCacheStore(config)
@@ -61,10 +85,67 @@ func NewProxy(config *config.Config) *Proxy {
 	return &Proxy{
 		Config:      config,
 		cache:       cache,
+		canary:      canary.NewRouter(config),
+		headers:     headers.NewHeaderModifier(config),
+		mirror:      mirror.NewMirror(config),
+		rewriter:    rewrite.NewRewriter(config),
 		transformer: transformer,
 	}
 }
 
+var transformerFactories = map[string]func(config *config.Config, components Components) transform.Transformer{
+	"app": func(c *config.Config, components Components) transform.Transformer {
+		return app.NewAppTransformer(c, components.Health)
+	},
+	"importmap": func(c *config.Config, components Components) transform.Transformer {
+		return importmap.NewImportMapTransformer(c, components.Integrity)
+	},
+	"meta": func(c *config.Config, components Components) transform.Transformer {
+		return meta.NewMetaTransformer(c, components.Localizer)
+	},
+	"navigation": func(c *config.Config, components Components) transform.Transformer {
+		return navigation.NewNavigationTransformer(c, components.Localizer)
+	},
+	"prune": func(c *config.Config, _ Components) transform.Transformer {
+		return prune.NewPruneTransformer(c)
+	},
+	"rewrite": func(c *config.Config, _ Components) transform.Transformer {
+		return rewrite.NewRewriteTransformer(c)
+	},
+	"rules": func(c *config.Config, _ Components) transform.Transformer {
+		return rules.NewRulesTransformer(c)
+	},
+	"state": func(c *config.Config, _ Components) transform.Transformer {
+		return state.NewBootstrapTransformer(c)
+	},
+}
+
+// NewTransformers builds the enabled transformers in the configured order,
+// each scoped to its configured paths and markers.
+func NewTransformers(config *config.Config, components Components) []transform.Transformer {
+	transformers := []transform.Transformer{}
+
+	for _, tc := range config.Transformers {
+		if tc.Disabled {
+			continue
+		}
+
+		factory, ok := transformerFactories[tc.Name]
+		if !ok {
+			log.Fatalf("Unknown transformer: %s", tc.Name)
+		}
+
+		scoped, err := transform.NewScopedTransformer(factory(config, components), tc)
+		if err != nil {
+			log.Fatalf("Invalid transformer: %v", err)
+		}
+
+		transformers = append(transformers, scoped)
+	}
+
+	return transformers
+}
+
 func (s *Proxy) Probe(w http.ResponseWriter, r *http.Request) {
 	url := fmt.Sprintf("%s://%s%s", util.GetScheme(r), s.Config.Proxy.UpstreamAddress, s.Config.Proxy.UpstreamHealthzPath)
 
@@ -98,7 +179,40 @@ func (s *Proxy) ReverseProxy() func(http.ResponseWriter, *http.Request) {
 		Rewrite:        s.rewrite,
 	}
 
-	return rp.ServeHTTP
+	if s.mirror == nil {
+		return rp.ServeHTTP
+	}
+
+	// The shadow request is a copy of the rewritten primary one, so the
+	// shadow upstream sees identical paths, headers and variant.
+	rp.Rewrite = func(pr *httputil.ProxyRequest) {
+		s.rewrite(pr)
+
+		if shadow, ok := pr.In.Context().Value(shadowKey{}).(*shadowRequest); ok {
+			shadow.out = pr.Out.Clone(context.Background())
+		}
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !s.mirror.Sample(r) {
+			rp.ServeHTTP(w, r)
+			return
+		}
+
+		shadow := &shadowRequest{}
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		start := time.Now()
+		rp.ServeHTTP(recorder, r.WithContext(context.WithValue(r.Context(), shadowKey{}, shadow)))
+		if shadow.out != nil {
+			s.mirror.Send(shadow.out, recorder.status, time.Since(start))
+		}
+	}
+}
+
+type shadowKey struct{}
+
+type shadowRequest struct {
+	out *http.Request
 }
 
 func (s *Proxy) errorHandler(w http.ResponseWriter, r *http.Request, err error) {
@@ -128,13 +242,32 @@ func (s *Proxy) joinURLPath(a, b *url.URL) (path, rawPath string) {
 }
 
 func (s *Proxy) modifyResponse(r *http.Response) error {
+	if s.rewriter != nil {
+		s.rewriter.RewriteResponse(r)
+	}
+
+	if err := s.transformResponse(r); err != nil {
+		return err
+	}
+
+	if s.headers != nil {
+		s.headers.ModifyResponse(r)
+	}
+
+	if variant, ok := r.Request.Context().Value(kctx.VariantKey).(kctx.Variant); ok && variant.Persist && s.canary != nil {
+		r.Header.Add("Set-Cookie", s.canary.Cookie(variant).String())
+	}
+
+	return nil
+}
+
+func (s *Proxy) transformResponse(r *http.Response) error {
 	proxiedEtag, ok := r.Request.Context().Value(kctx.ProxiedEtagKey).(string)
 
 	if !ok {
 		proxiedEtag = ""
 	}
 
-	configHash := s.Config.Hash()
 	cacheHit := false
 
 	if r.StatusCode == http.StatusNotFound {
@@ -145,12 +278,13 @@ func (s *Proxy) modifyResponse(r *http.Response) error {
 	if r.StatusCode == http.StatusNotModified {
 		upstreamETag := r.Header.Get("ETag")
 		if upstreamETag != "" {
-			derivedETag := fmt.Sprintf(`%s-t%x`, upstreamETag, configHash)
+			variantKey := s.variantKey(r.Request)
+			derivedETag := fmt.Sprintf(`%s-t%x`, upstreamETag, s.etagHash(r.Request, variantKey))
 
 			if derivedETag == proxiedEtag {
-				r.Header.Set("Cache-Control", "no-cache")
+				s.setHTMLCacheControl(r, variantKey != "")
 				r.Header.Set("ETag", derivedETag)
-				r.Header.Add("Vary", "Authorization")
+				s.setVary(r)
 
 				return nil
 			}
@@ -183,10 +317,6 @@ func (s *Proxy) modifyResponse(r *http.Response) error {
 	}
 
 	upstreamETag := r.Header.Get("ETag")
-	if upstreamETag != "" {
-		derivedETag := fmt.Sprintf(`%s-t%x`, upstreamETag, configHash)
-		r.Header.Set("ETag", derivedETag)
-	}
 
 	// Check for chunked transfer encoding
 	isChunked := len(r.TransferEncoding) > 0 && r.TransferEncoding[0] == "chunked"
@@ -216,20 +346,34 @@ func (s *Proxy) modifyResponse(r *http.Response) error {
 		return fmt.Errorf("failed to parse HTML: %w", err)
 	}
 
+	transformedBody := body
 	if err := s.transformer.Transform(r, doc); err != nil {
-		return fmt.Errorf("failed to transform response: %w", err)
+		if !errors.Is(err, transform.ErrServeOriginal) {
+			return fmt.Errorf("failed to transform response: %w", err)
+		}
+
+		// The derived ETag would pin the untransformed content in client
+		// caches, so drop it.
+		log.Printf("Serving untransformed response for %s: %v", r.Request.URL.Path, err)
+		r.Header.Del("ETag")
+	} else {
+		var buf bytes.Buffer
+		if err := html.Render(&buf, doc); err != nil {
+			return fmt.Errorf("failed to render HTML: %w", err)
+		}
+		transformedBody = buf.Bytes()
 	}
 
-	var buf bytes.Buffer
-	if err := html.Render(&buf, doc); err != nil {
-		return fmt.Errorf("failed to render HTML: %w", err)
+	// Transformers learn what the page varies by while transforming it.
+	variantKey := s.variantKey(r.Request)
+	if upstreamETag != "" && r.Header.Get("ETag") != "" {
+		r.Header.Set("ETag", fmt.Sprintf(`%s-t%x`, upstreamETag, s.etagHash(r.Request, variantKey)))
 	}
 
-	transformedBody := buf.Bytes()
 	r.Body = io.NopCloser(bytes.NewReader(transformedBody))
 
-	r.Header.Set("Cache-Control", "no-cache")
-	r.Header.Add("Vary", "Authorization")
+	s.setHTMLCacheControl(r, variantKey != "")
+	s.setVary(r)
 
 	// Handle transfer encoding
 	if isChunked {
@@ -243,10 +387,92 @@ func (s *Proxy) modifyResponse(r *http.Response) error {
 	return nil
 }
 
+// variantKey identifies the per-request variant the transformers produce,
+// such as a page embedding the user's state. It's empty when the output
+// doesn't vary by request.
+func (s *Proxy) variantKey(r *http.Request) string {
+	if varier, ok := s.transformer.(transform.Varier); ok {
+		return varier.VariantKey(r)
+	}
+	return ""
+}
+
+// etagHash folds the inputs a transformed page varies by into the config
+// hash, so each variant of a page gets its own validator.
+func (s *Proxy) etagHash(r *http.Request, variantKey string) uint32 {
+	hash := s.Config.Hash()
+	if locale, ok := r.Context().Value(kctx.LocaleKey).(string); ok && locale != "" {
+		hash = crc32.Update(hash, crc32.IEEETable, []byte(locale))
+	}
+	if variant, ok := r.Context().Value(kctx.VariantKey).(kctx.Variant); ok && variant.Name != canary.Stable {
+		hash = crc32.Update(hash, crc32.IEEETable, []byte(variant.Name))
+	}
+	if variantKey != "" {
+		hash = crc32.Update(hash, crc32.IEEETable, []byte(variantKey))
+	}
+	return hash
+}
+
+func (s *Proxy) setVary(r *http.Response) {
+	addVary(r.Header, "Authorization")
+	if _, ok := r.Request.Context().Value(kctx.LocaleKey).(string); ok {
+		addVary(r.Header, "Accept-Language")
+		// The locale cookie takes precedence over Accept-Language, so a
+		// response negotiated without it doesn't fit a request with it.
+		if s.Config.Locale.CookieName != "" {
+			addVary(r.Header, "Cookie")
+		}
+	}
+	if s.canary != nil {
+		addVary(r.Header, s.canary.Vary()...)
+	}
+}
+
+// addVary adds the headers to Vary unless they are listed already.
+func addVary(header http.Header, names ...string) {
+	for _, name := range names {
+		listed := false
+		for _, value := range header.Values("Vary") {
+			for _, field := range strings.Split(value, ",") {
+				if strings.EqualFold(strings.TrimSpace(field), name) {
+					listed = true
+				}
+			}
+		}
+		if !listed {
+			header.Add("Vary", name)
+		}
+	}
+}
+
+// setHTMLCacheControl applies the configured Cache-Control. Pages varying
+// by request are kept out of shared caches.
+func (s *Proxy) setHTMLCacheControl(r *http.Response, private bool) {
+	if s.Config.Proxy.Headers.HTMLCacheControl != "" {
+		r.Header.Set("Cache-Control", s.Config.Proxy.Headers.HTMLCacheControl)
+	}
+
+	if !private {
+		return
+	}
+
+	r.Header.Set("Cache-Control", util.PrivateCacheControl(r.Header.Get("Cache-Control")))
+}
+
 func (s *Proxy) rewrite(r *httputil.ProxyRequest) {
+	variant := kctx.Variant{Name: canary.Stable}
+	if s.canary != nil {
+		variant = s.canary.Select(r.In)
+	}
+
+	upstreamAddress := s.Config.Proxy.UpstreamAddress
+	if variant.Name == canary.Canary && s.Config.Proxy.Canary.Address != "" {
+		upstreamAddress = s.Config.Proxy.Canary.Address
+	}
+
 	target := &url.URL{
 		Scheme:   s.Config.Proxy.UpstreamScheme,
-		Host:     s.Config.Proxy.UpstreamAddress,
+		Host:     upstreamAddress,
 		Path:     s.Config.Proxy.UpstreamPrefix,
 		RawQuery: r.In.URL.RawQuery,
 	}
@@ -269,11 +495,27 @@ func (s *Proxy) rewrite(r *httputil.ProxyRequest) {
 	// If there is a match we need to set the AppAlias and AppPath
 
 	strippedURLPath := strings.TrimSuffix(req.URL.Path, "/")
+	routeParams := map[string]string{}
 
 	for _, templatePath := range s.Config.Navigation.TemplatePaths {
-		if strings.HasPrefix(strippedURLPath, templatePath.Href) {
-			req.URL.Path = templatePath.Template + strings.TrimPrefix(req.URL.Path, templatePath.Href)
+		if !util.IsRoutePattern(templatePath.Href) {
+			if strings.HasPrefix(strippedURLPath, templatePath.Href) {
+				req.URL.Path = templatePath.Template + strings.TrimPrefix(req.URL.Path, templatePath.Href)
+			}
+			continue
+		}
+
+		params, rest, ok := util.MatchRoute(templatePath.Href, req.URL.Path)
+		if !ok {
+			continue
+		}
+		template, ok := util.ExpandRoute(templatePath.Template, params)
+		if !ok {
+			log.Printf("Template %s uses parameters missing from %s", templatePath.Template, templatePath.Href)
+			continue
 		}
+		req.URL.Path = template + rest
+		routeParams = params
 	}
 
 	req.URL.Path, req.URL.RawPath = s.joinURLPath(target, req.URL)
@@ -285,7 +527,7 @@ func (s *Proxy) rewrite(r *httputil.ProxyRequest) {
 		req.URL.Path = req.URL.Path + s.Config.Proxy.IndexFile
 	}
 
-	log.Printf("Path rewritten '%s' to '%s', Alias: '%s', Path: '%s', Upstream: '%s'", r.In.URL.Path, req.URL.Path, proxiedParts.AppAlias, proxiedParts.AppPath, req.URL.String())
+	log.Printf("Path rewritten '%s' to '%s', Alias: '%s', Path: '%s', Upstream: '%s', Variant: '%s'", r.In.URL.Path, req.URL.Path, proxiedParts.AppAlias, proxiedParts.AppPath, req.URL.String(), variant.Name)
 
 	if targetQuery == "" || req.URL.RawQuery == "" {
 		req.URL.RawQuery = targetQuery + req.URL.RawQuery
@@ -304,7 +546,12 @@ func (s *Proxy) rewrite(r *httputil.ProxyRequest) {
 		}
 	}
 
+	req = req.WithContext(context.WithValue(req.Context(), kctx.MemoKey, &kctx.Memo{}))
 	req = req.WithContext(context.WithValue(req.Context(), kctx.ProxiedPartsKey, proxiedParts))
+	req = req.WithContext(context.WithValue(req.Context(), kctx.PublicOriginKey, publicOrigin(r.In)))
+	req = req.WithContext(context.WithValue(req.Context(), kctx.RequestPathKey, r.In.URL.Path))
+	req = req.WithContext(context.WithValue(req.Context(), kctx.RouteParamsKey, routeParams))
+	req = req.WithContext(context.WithValue(req.Context(), kctx.VariantKey, variant))
 
 	{
 		// Everything bellow is about Proxy Protocol
@@ -314,6 +561,10 @@ func (s *Proxy) rewrite(r *httputil.ProxyRequest) {
 		setForwarded(r.In, req)
 	}
 
+	if s.headers != nil {
+		s.headers.ModifyRequest(r.In, req)
+	}
+
 	r.Out = req
 }
 
@@ -378,6 +629,20 @@ func (s *Proxy) singleJoiningSlash(a, b string) string {
 	return a + b
 }
 
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (rec *statusRecorder) WriteHeader(code int) {
+	rec.status = code
+	rec.ResponseWriter.WriteHeader(code)
+}
+
+func (rec *statusRecorder) Unwrap() http.ResponseWriter {
+	return rec.ResponseWriter
+}
+
 func getOutboundIP() net.IP {
 	conn, err := net.Dial("udp", "8.8.8.8:80")
 	if err != nil {
@@ -390,6 +655,20 @@ func getOutboundIP() net.IP {
 	return localAddr.IP
 }
 
+func publicOrigin(in *http.Request) kctx.PublicOrigin {
+	scheme := util.GetScheme(in)
+	if proto := in.Header.Get("X-Forwarded-Proto"); proto != "" {
+		scheme = proto
+	} else if in.TLS != nil {
+		scheme = "https"
+	}
+
+	return kctx.PublicOrigin{
+		Host:   in.Host,
+		Scheme: scheme,
+	}
+}
+
 func setForwarded(in *http.Request, out *http.Request) {
 	out.Header.Set(
 		"Forwarded",
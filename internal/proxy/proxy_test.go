@@ -15,6 +15,7 @@
 package proxy
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -24,12 +25,17 @@ import (
 	"net/url"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"kdex.dev/proxy/internal/app"
+	"kdex.dev/proxy/internal/canary"
 	"kdex.dev/proxy/internal/config"
+	kctx "kdex.dev/proxy/internal/context"
 	"kdex.dev/proxy/internal/importmap"
+	"kdex.dev/proxy/internal/locale"
 	"kdex.dev/proxy/internal/meta"
+	"kdex.dev/proxy/internal/mirror"
 	"kdex.dev/proxy/internal/navigation"
 	"kdex.dev/proxy/internal/store/cache"
 	"kdex.dev/proxy/internal/transform"
@@ -750,12 +756,23 @@ func TestServer_rewrite(t *testing.T) {
 			Template: "/template",
 			Weight:   1,
 		},
+		{
+			Href:     "/products/{id}/reviews",
+			Label:    "Reviews",
+			Template: "/product-reviews",
+		},
+		{
+			Href:     "/shops/{shop}/items/{item}",
+			Label:    "Item",
+			Template: "/shops/{shop}/item",
+		},
 	}
 
 	tests := []struct {
-		name string
-		r    *httputil.ProxyRequest
-		want *url.URL
+		name       string
+		r          *httputil.ProxyRequest
+		want       *url.URL
+		wantParams map[string]string
 	}{
 		{
 			name: "test",
@@ -799,12 +816,202 @@ func TestServer_rewrite(t *testing.T) {
 			},
 			want: &url.URL{Path: "/css/base.min.2fbd9dd903cac0d10e1ae4765ed55e6f79bf4e4728d27a56f74dae99768ca735.css", Scheme: "http", Host: "target-server"},
 		},
+		{
+			name: "route with parameters",
+			r: &httputil.ProxyRequest{
+				In: &http.Request{
+					URL:    &url.URL{Path: "/products/42/reviews", Scheme: "http", Host: "localhost"},
+					Header: http.Header{},
+				},
+				Out: &http.Request{
+					URL:    &url.URL{},
+					Header: http.Header{},
+				},
+			},
+			want:       &url.URL{Path: "/product-reviews", Scheme: "http", Host: "target-server"},
+			wantParams: map[string]string{"id": "42"},
+		},
+		{
+			name: "route with parameters and app path",
+			r: &httputil.ProxyRequest{
+				In: &http.Request{
+					URL:    &url.URL{Path: "/products/42/reviews/_/ta/latest", Scheme: "http", Host: "localhost"},
+					Header: http.Header{},
+				},
+				Out: &http.Request{
+					URL:    &url.URL{},
+					Header: http.Header{},
+				},
+			},
+			want:       &url.URL{Path: "/product-reviews", Scheme: "http", Host: "target-server"},
+			wantParams: map[string]string{"id": "42"},
+		},
+		{
+			name: "route parameters used in the template",
+			r: &httputil.ProxyRequest{
+				In: &http.Request{
+					URL:    &url.URL{Path: "/shops/north/items/7", Scheme: "http", Host: "localhost"},
+					Header: http.Header{},
+				},
+				Out: &http.Request{
+					URL:    &url.URL{},
+					Header: http.Header{},
+				},
+			},
+			want:       &url.URL{Path: "/shops/north/item", Scheme: "http", Host: "target-server"},
+			wantParams: map[string]string{"item": "7", "shop": "north"},
+		},
+		{
+			name: "route not matching",
+			r: &httputil.ProxyRequest{
+				In: &http.Request{
+					URL:    &url.URL{Path: "/products/42", Scheme: "http", Host: "localhost"},
+					Header: http.Header{},
+				},
+				Out: &http.Request{
+					URL:    &url.URL{},
+					Header: http.Header{},
+				},
+			},
+			want:       &url.URL{Path: "/products/42", Scheme: "http", Host: "target-server"},
+			wantParams: map[string]string{},
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			s := NewProxy(defaultConfig)
+			s := NewProxy(defaultConfig, Components{})
 			s.rewrite(tt.r)
 			assert.Equal(t, tt.want, tt.r.Out.URL)
+			if tt.wantParams != nil {
+				assert.Equal(t, tt.wantParams, tt.r.Out.Context().Value(kctx.RouteParamsKey))
+			}
 		})
 	}
 }
+
+func TestNewTransformers(t *testing.T) {
+	c := *config.DefaultConfig()
+	c.Transformers = []config.TransformerConfig{
+		{Name: "meta"},
+		{Name: "navigation", Disabled: true},
+		{Name: "app", Paths: []string{"/apps/*"}},
+	}
+
+	transformers := NewTransformers(&c, Components{Localizer: locale.NewLocalizer(&c)})
+
+	names := []string{}
+	for _, tr := range transformers {
+		names = append(names, tr.(*transform.ScopedTransformer).Name)
+	}
+	assert.Equal(t, []string{"meta", "app"}, names)
+}
+
+func TestServer_setHTMLCacheControl(t *testing.T) {
+	tests := []struct {
+		name     string
+		config   string
+		upstream string
+		private  bool
+		want     string
+	}{
+		{name: "configured", config: "no-cache", upstream: "max-age=60", want: "no-cache"},
+		{name: "upstream kept", config: "", upstream: "max-age=60", want: "max-age=60"},
+		{name: "private", config: "no-cache", private: true, want: "private, no-cache"},
+		{name: "public replaced", config: "", upstream: "public, max-age=60", private: true, want: "private, max-age=60"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := *config.DefaultConfig()
+			c.Proxy.Headers.HTMLCacheControl = tt.config
+			s := &Proxy{Config: &c}
+
+			r := &http.Response{Header: http.Header{}}
+			if tt.upstream != "" {
+				r.Header.Set("Cache-Control", tt.upstream)
+			}
+			s.setHTMLCacheControl(r, tt.private)
+			assert.Equal(t, tt.want, r.Header.Get("Cache-Control"))
+		})
+	}
+}
+
+func TestServer_ReverseProxy_mirror(t *testing.T) {
+	primaryPaths := make(chan string, 1)
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		primaryPaths <- r.URL.Path
+		w.Write([]byte("primary"))
+	}))
+	defer primary.Close()
+
+	shadowPaths := make(chan string, 1)
+	shadow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		shadowPaths <- r.URL.Path
+	}))
+	defer shadow.Close()
+
+	c := config.DefaultConfig()
+	c.Proxy.UpstreamAddress = strings.TrimPrefix(primary.URL, "http://")
+	c.Proxy.UpstreamPrefix = "/site"
+	c.Proxy.Mirror = config.MirrorConfig{
+		Address:    strings.TrimPrefix(shadow.URL, "http://"),
+		Methods:    []string{"GET"},
+		Percentage: 100,
+		Scheme:     "http",
+		Timeout:    time.Second,
+	}
+
+	s := Proxy{
+		Config:      c,
+		mirror:      mirror.NewMirror(c),
+		transformer: &transform.AggregatedTransformer{},
+	}
+	proxyServer := httptest.NewServer(http.HandlerFunc(s.ReverseProxy()))
+	defer proxyServer.Close()
+
+	resp, err := http.Get(proxyServer.URL + "/posts/")
+	assert.NoError(t, err)
+	resp.Body.Close()
+
+	primaryPath := <-primaryPaths
+	assert.Equal(t, "/site/posts/", primaryPath)
+
+	select {
+	case shadowPath := <-shadowPaths:
+		assert.Equal(t, primaryPath, shadowPath)
+	case <-time.After(time.Second):
+		t.Fatal("shadow request not sent")
+	}
+}
+
+func TestServer_etagHash_variant(t *testing.T) {
+	c := config.DefaultConfig()
+	c.Proxy.Canary = config.CanaryConfig{Address: "canary", CookieName: "kdex_variant", Header: "X-Variant"}
+	s := Proxy{Config: c, canary: canary.NewRouter(c)}
+
+	request := func(name string) *http.Request {
+		r := httptest.NewRequest("GET", "/", nil)
+		return r.WithContext(context.WithValue(r.Context(), kctx.VariantKey, kctx.Variant{Name: name}))
+	}
+
+	assert.Equal(t, c.Hash(), s.etagHash(request(canary.Stable), ""))
+	assert.NotEqual(t, s.etagHash(request(canary.Stable), ""), s.etagHash(request(canary.Canary), ""))
+
+	r := &http.Response{Header: http.Header{}, Request: request(canary.Canary)}
+	s.setVary(r)
+	s.setVary(r)
+	assert.Equal(t, []string{"Authorization", "Cookie", "X-Variant"}, r.Header.Values("Vary"))
+}
+
+func TestServer_setVary_locale(t *testing.T) {
+	c := config.DefaultConfig()
+	s := Proxy{Config: c}
+
+	r := httptest.NewRequest("GET", "/", nil)
+	resp := &http.Response{Header: http.Header{}, Request: r}
+	s.setVary(resp)
+	assert.Equal(t, []string{"Authorization"}, resp.Header.Values("Vary"))
+
+	resp = &http.Response{Header: http.Header{}, Request: r.WithContext(context.WithValue(r.Context(), kctx.LocaleKey, "fr"))}
+	s.setVary(resp)
+	assert.Equal(t, []string{"Authorization", "Accept-Language", "Cookie"}, resp.Header.Values("Vary"))
+}
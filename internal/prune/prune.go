@@ -0,0 +1,172 @@
+// Copyright 2025 KDex Tech
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prune
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+
+	"golang.org/x/net/html"
+	"kdex.dev/proxy/internal/check"
+	"kdex.dev/proxy/internal/config"
+	kctx "kdex.dev/proxy/internal/context"
+	"kdex.dev/proxy/internal/dom"
+	"kdex.dev/proxy/internal/transform"
+)
+
+const (
+	ModeMark   = "mark"
+	ModeRemove = "remove"
+)
+
+// maxPages bounds how many pages are remembered as prunable or not.
+const maxPages = 10000
+
+// PruneTransformer removes (or marks) elements annotated with a resource the
+// user isn't permitted to access, so they never reach the browser.
+type PruneTransformer struct {
+	transform.Transformer
+	Checker *check.Checker
+	Config  *config.PruneConfig
+	mu      sync.Mutex
+	pages   map[string]bool // By page path: whether it had annotated elements
+}
+
+func NewPruneTransformer(config *config.Config) *PruneTransformer {
+	switch config.Authz.Prune.Mode {
+	case ModeMark, ModeRemove:
+	default:
+		log.Fatalf("Invalid prune mode: %s", config.Authz.Prune.Mode)
+	}
+
+	return &PruneTransformer{
+		Checker: check.NewChecker(config),
+		Config:  &config.Authz.Prune,
+		pages:   map[string]bool{},
+	}
+}
+
+func (t *PruneTransformer) Transform(r *http.Response, doc *html.Node) error {
+	nodes := t.annotated(doc)
+	t.remember(r.Request, len(nodes) > 0)
+	if len(nodes) == 0 {
+		return nil
+	}
+
+	tuples := []check.CheckBatchTuples{}
+	index := map[check.CheckBatchTuples]int{}
+	for _, node := range nodes {
+		tuple := t.tuple(node)
+		if _, ok := index[tuple]; !ok {
+			index[tuple] = len(tuples)
+			tuples = append(tuples, tuple)
+		}
+	}
+
+	allowed := make([]bool, len(tuples))
+	if t.Checker != nil && t.Checker.PermissionProvider != nil {
+		results, err := t.Checker.CheckBatch(r.Request.Context(), tuples)
+		if err != nil && !errors.Is(err, check.ErrNoRoles) {
+			return fmt.Errorf("failed to check permissions: %w", err)
+		}
+		for i, result := range results {
+			allowed[i] = result.Allowed
+		}
+	}
+
+	for _, node := range nodes {
+		if allowed[index[t.tuple(node)]] {
+			continue
+		}
+
+		switch t.Config.Mode {
+		case ModeMark:
+			dom.SetAttribute(node, t.Config.MarkAttribute, "")
+			dom.SetAttribute(node, "hidden", "")
+		default:
+			if node.Parent != nil {
+				node.Parent.RemoveChild(node)
+			}
+		}
+	}
+
+	return nil
+}
+
+// VariantKey identifies the permissions the pruned page depends on. Pages
+// that had no annotated elements when last transformed don't vary; pages not
+// seen yet are assumed to.
+func (t *PruneTransformer) VariantKey(r *http.Request) string {
+	t.mu.Lock()
+	prunable, known := t.pages[pagePath(r)]
+	t.mu.Unlock()
+
+	if known && !prunable {
+		return ""
+	}
+	return t.Checker.RolesKey(r.Context())
+}
+
+func (t *PruneTransformer) remember(r *http.Request, prunable bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.pages == nil || len(t.pages) >= maxPages {
+		t.pages = map[string]bool{}
+	}
+	t.pages[pagePath(r)] = prunable
+}
+
+func pagePath(r *http.Request) string {
+	if path, ok := r.Context().Value(kctx.RequestPathKey).(string); ok {
+		return path
+	}
+	return r.URL.Path
+}
+
+// annotated collects every annotated element, since an element the user may
+// access can hold one the user may not. Removing an element whose ancestor
+// was removed already is harmless.
+func (t *PruneTransformer) annotated(doc *html.Node) []*html.Node {
+	nodes := []*html.Node{}
+
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode && dom.GetAttribute(n, t.Config.ResourceAttribute) != "" {
+			nodes = append(nodes, n)
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(doc)
+
+	return nodes
+}
+
+func (t *PruneTransformer) tuple(node *html.Node) check.CheckBatchTuples {
+	action := dom.GetAttribute(node, t.Config.ActionAttribute)
+	if action == "" {
+		action = t.Config.DefaultAction
+	}
+
+	return check.CheckBatchTuples{
+		Action:   action,
+		Resource: dom.GetAttribute(node, t.Config.ResourceAttribute),
+	}
+}
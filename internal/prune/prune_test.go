@@ -0,0 +1,160 @@
+// Copyright 2025 KDex Tech
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package prune
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"kdex.dev/proxy/internal/config"
+	kctx "kdex.dev/proxy/internal/context"
+	"kdex.dev/proxy/internal/util"
+)
+
+func TestPruneTransformer_Transform(t *testing.T) {
+	permissions := []config.Permission{
+		{Resource: "page:/admin", Action: "read", Principal: "admin"},
+		{Resource: "page:/docs", Action: "read", Principal: "*"},
+		{Resource: "api:/orders", Action: "write", Principal: "admin"},
+		{Resource: "api:/orders", Action: "read", Principal: "user"},
+	}
+
+	tests := []struct {
+		name  string
+		mode  string
+		roles []string
+		doc   string
+		want  string
+	}{
+		{
+			name:  "no annotations",
+			mode:  ModeRemove,
+			roles: []string{"user"},
+			doc:   `<html><head></head><body><a href="/admin">Admin</a></body></html>`,
+			want:  `<html><head></head><body><a href="/admin">Admin</a></body></html>`,
+		},
+		{
+			name:  "remove denied",
+			mode:  ModeRemove,
+			roles: []string{"user"},
+			doc:   `<html><head></head><body><a data-kdex-resource="page:/admin">Admin</a><a data-kdex-resource="page:/docs">Docs</a></body></html>`,
+			want:  `<html><head></head><body><a data-kdex-resource="page:/docs">Docs</a></body></html>`,
+		},
+		{
+			name:  "allowed by role",
+			mode:  ModeRemove,
+			roles: []string{"admin"},
+			doc:   `<html><head></head><body><a data-kdex-resource="page:/admin">Admin</a></body></html>`,
+			want:  `<html><head></head><body><a data-kdex-resource="page:/admin">Admin</a></body></html>`,
+		},
+		{
+			name:  "explicit action",
+			mode:  ModeRemove,
+			roles: []string{"user"},
+			doc:   `<html><head></head><body><button data-kdex-resource="api:/orders" data-kdex-action="write">Edit</button><span data-kdex-resource="api:/orders">Orders</span></body></html>`,
+			want:  `<html><head></head><body><span data-kdex-resource="api:/orders">Orders</span></body></html>`,
+		},
+		{
+			name:  "resource without permissions",
+			mode:  ModeRemove,
+			roles: []string{"admin"},
+			doc:   `<html><head></head><body><a data-kdex-resource="page:/unknown">Unknown</a></body></html>`,
+			want:  `<html><head></head><body></body></html>`,
+		},
+		{
+			name:  "no roles",
+			mode:  ModeRemove,
+			roles: nil,
+			doc:   `<html><head></head><body><a data-kdex-resource="page:/docs">Docs</a></body></html>`,
+			want:  `<html><head></head><body></body></html>`,
+		},
+		{
+			name:  "nested removed with parent",
+			mode:  ModeRemove,
+			roles: []string{"user"},
+			doc:   `<html><head></head><body><div data-kdex-resource="page:/admin"><a data-kdex-resource="page:/docs">Docs</a></div></body></html>`,
+			want:  `<html><head></head><body></body></html>`,
+		},
+		{
+			name:  "denied inside allowed",
+			mode:  ModeRemove,
+			roles: []string{"user"},
+			doc:   `<html><head></head><body><div data-kdex-resource="page:/docs"><p>Docs</p><section data-kdex-resource="page:/admin">Secret</section></div></body></html>`,
+			want:  `<html><head></head><body><div data-kdex-resource="page:/docs"><p>Docs</p></div></body></html>`,
+		},
+		{
+			name:  "mark denied",
+			mode:  ModeMark,
+			roles: []string{"user"},
+			doc:   `<html><head></head><body><a data-kdex-resource="page:/admin">Admin</a></body></html>`,
+			want:  `<html><head></head><body><a data-kdex-resource="page:/admin" data-kdex-denied="" hidden="">Admin</a></body></html>`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := *config.DefaultConfig()
+			c.Authz.Prune.Mode = tt.mode
+			c.Authz.Static.Permissions = permissions
+
+			transformer := NewPruneTransformer(&c)
+
+			req := httptest.NewRequest("GET", "/", nil)
+			if tt.roles != nil {
+				req = req.WithContext(context.WithValue(req.Context(), kctx.UserRolesKey, tt.roles))
+			}
+
+			doc := util.ToDoc(tt.doc)
+			err := transformer.Transform(&http.Response{Request: req}, doc)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, util.FromDoc(doc))
+		})
+	}
+}
+
+func TestPruneTransformer_VariantKey(t *testing.T) {
+	c := *config.DefaultConfig()
+	c.Authz.Static.Permissions = []config.Permission{{Resource: "page:/admin", Action: "read", Principal: "admin"}}
+	transformer := NewPruneTransformer(&c)
+
+	key := func(roles ...string) string {
+		req := httptest.NewRequest("GET", "/", nil)
+		return transformer.VariantKey(req.WithContext(context.WithValue(req.Context(), kctx.UserRolesKey, roles)))
+	}
+
+	assert.NotEmpty(t, key())
+	assert.Equal(t, key("admin", "user"), key("user", "admin"))
+	assert.NotEqual(t, key("user"), key("admin", "user"))
+
+	transform := func(path string, page string) {
+		req := httptest.NewRequest("GET", "/upstream", nil)
+		req = req.WithContext(context.WithValue(req.Context(), kctx.RequestPathKey, path))
+		assert.NoError(t, transformer.Transform(&http.Response{Request: req}, util.ToDoc(page)))
+	}
+	pageKey := func(path string) string {
+		req := httptest.NewRequest("GET", "/upstream", nil)
+		ctx := context.WithValue(req.Context(), kctx.RequestPathKey, path)
+		return transformer.VariantKey(req.WithContext(context.WithValue(ctx, kctx.UserRolesKey, []string{"user"})))
+	}
+
+	transform("/plain", `<p>public</p>`)
+	assert.Empty(t, pageKey("/plain"), "pages without annotated elements stay shared")
+
+	transform("/guarded", `<p data-kdex-resource="page:/admin">admin</p>`)
+	assert.NotEmpty(t, pageKey("/guarded"))
+	assert.NotEmpty(t, pageKey("/unseen"), "unseen pages are assumed to vary")
+}
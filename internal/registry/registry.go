@@ -0,0 +1,282 @@
+// Copyright 2025 KDex Tech
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package registry
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"kdex.dev/proxy/internal/check"
+	"kdex.dev/proxy/internal/config"
+	appstore "kdex.dev/proxy/internal/store/app"
+)
+
+const Resource = "registry:apps"
+
+// Registry serves an API to register, update and remove apps at runtime and
+// provides the registered apps to the proxy next to the configured ones.
+// Changes take effect on the next request.
+type Registry struct {
+	Checker  *check.Checker
+	Config   *config.Config
+	Store    appstore.AppStore
+	apps     []config.App
+	loadedAt time.Time
+	mu       sync.RWMutex
+}
+
+// NewRegistry returns nil unless the registry is enabled. The registry adds
+// itself to the config's app providers.
+func NewRegistry(config *config.Config) *Registry {
+	if !config.Registry.Enabled {
+		return nil
+	}
+
+	store, err := appstore.NewAppStore(config)
+	if err != nil {
+		log.Fatalf("Invalid app registry: %v", err)
+	}
+
+	r := &Registry{
+		Checker: check.NewChecker(config),
+		Config:  config,
+		Store:   store,
+	}
+
+	if err := r.load(context.Background()); err != nil {
+		log.Fatalf("Error loading registered apps: %v", err)
+	}
+
+	config.AddAppProvider(r)
+
+	return r
+}
+
+// Apps returns the registered apps. With a refresh interval the apps are
+// reloaded from the store once stale, so changes made to it outside the proxy
+// are picked up; a failed reload keeps the previous apps.
+func (r *Registry) Apps() []config.App {
+	r.mu.RLock()
+	apps := r.apps
+	stale := r.Config.Registry.Refresh > 0 && time.Since(r.loadedAt) > r.Config.Registry.Refresh
+	r.mu.RUnlock()
+
+	if !stale {
+		return apps
+	}
+
+	if err := r.load(context.Background()); err != nil {
+		log.Printf("Error reloading registered apps: %v", err)
+		return apps
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.apps
+}
+
+// Handler serves the registry API under the endpoint:
+//
+//	GET    <endpoint>          lists the registered apps
+//	GET    <endpoint>/{alias}  returns a registered app
+//	PUT    <endpoint>/{alias}  registers or updates an app
+//	DELETE <endpoint>/{alias}  removes an app
+//
+// Reading requires the read action on registry:apps and changes the write
+// action.
+func (r *Registry) Handler() http.Handler {
+	endpoint := strings.TrimSuffix(r.Config.Registry.Endpoint, "/")
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET "+endpoint, r.authorized("read", r.listHandler))
+	mux.HandleFunc("GET "+endpoint+"/{alias}", r.authorized("read", r.getHandler))
+	mux.HandleFunc("PUT "+endpoint+"/{alias}", r.authorized("write", r.putHandler))
+	mux.HandleFunc("DELETE "+endpoint+"/{alias}", r.authorized("write", r.deleteHandler))
+	return mux
+}
+
+func (r *Registry) authorized(action string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		if r.Checker == nil || r.Checker.PermissionProvider == nil {
+			writeError(w, http.StatusForbidden, errors.New("forbidden"))
+			return
+		}
+
+		allowed, err := r.Checker.Check(req.Context(), Resource, action)
+		if err != nil && !errors.Is(err, check.ErrNoRoles) {
+			log.Printf("Error checking registry permissions: %v", err)
+		}
+		if !allowed {
+			writeError(w, http.StatusForbidden, errors.New("forbidden"))
+			return
+		}
+
+		next(w, req)
+	}
+}
+
+func (r *Registry) listHandler(w http.ResponseWriter, req *http.Request) {
+	apps, err := r.Store.List(req.Context())
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, apps)
+}
+
+func (r *Registry) getHandler(w http.ResponseWriter, req *http.Request) {
+	alias, ok := pathAlias(w, req)
+	if !ok {
+		return
+	}
+
+	app, err := r.Store.Get(req.Context(), alias)
+	if errors.Is(err, appstore.ErrAppNotFound) {
+		writeError(w, http.StatusNotFound, err)
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, app)
+}
+
+func (r *Registry) putHandler(w http.ResponseWriter, req *http.Request) {
+	alias, ok := pathAlias(w, req)
+	if !ok {
+		return
+	}
+
+	if slices.ContainsFunc(r.Config.Apps, func(app config.App) bool { return app.Alias == alias }) {
+		writeError(w, http.StatusConflict, fmt.Errorf("app %s is configured statically", alias))
+		return
+	}
+
+	body, err := io.ReadAll(req.Body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	var app config.App
+	if err := json.Unmarshal(body, &app); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if app.Alias != "" && app.Alias != alias {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("app alias %s doesn't match %s", app.Alias, alias))
+		return
+	}
+	app.Alias = alias
+
+	if err := app.Validate(); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	created, err := r.Store.Set(req.Context(), app)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	status := http.StatusOK
+	if created {
+		status = http.StatusCreated
+	}
+
+	if err := r.load(req.Context()); err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	log.Printf("App %s registered", alias)
+	writeJSON(w, status, app)
+}
+
+func (r *Registry) deleteHandler(w http.ResponseWriter, req *http.Request) {
+	alias, ok := pathAlias(w, req)
+	if !ok {
+		return
+	}
+
+	err := r.Store.Delete(req.Context(), alias)
+	if errors.Is(err, appstore.ErrAppNotFound) {
+		writeError(w, http.StatusNotFound, err)
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	if err := r.load(req.Context()); err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	log.Printf("App %s removed", alias)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// pathAlias returns the alias in the request path, or writes an error when
+// it isn't one config validation accepts.
+func pathAlias(w http.ResponseWriter, req *http.Request) (string, bool) {
+	alias := req.PathValue("alias")
+	if err := config.ValidateAlias(alias); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return "", false
+	}
+	return alias, true
+}
+
+func (r *Registry) load(ctx context.Context) error {
+	apps, err := r.Store.List(ctx)
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.apps = apps
+	r.loadedAt = time.Now()
+	return nil
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	body, _ := json.Marshal(map[string]string{"error": err.Error()})
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(body)
+}
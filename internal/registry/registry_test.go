@@ -0,0 +1,129 @@
+// Copyright 2025 KDex Tech
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package registry
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"kdex.dev/proxy/internal/config"
+	kctx "kdex.dev/proxy/internal/context"
+)
+
+func TestRegistry_Handler(t *testing.T) {
+	for _, store := range []string{"memory", "file"} {
+		t.Run(store, func(t *testing.T) {
+			c := &config.Config{
+				Apps: []config.App{
+					{Address: "static-app", Alias: "static", Element: "static-app", Path: "/app.js", Targets: []config.Target{{Path: "/"}}},
+				},
+				Authz: config.AuthzConfig{
+					Provider: "static",
+					Static: config.StaticAuthzProviderConfig{
+						Permissions: []config.Permission{
+							{Action: "*", Principal: "admin", Resource: Resource},
+							{Action: "read", Principal: "viewer", Resource: Resource},
+						},
+					},
+				},
+				Registry: config.RegistryConfig{
+					Enabled:  true,
+					Endpoint: "/~/registry/apps",
+					File:     filepath.Join(t.TempDir(), "apps.json"),
+					Store:    store,
+				},
+			}
+			r := NewRegistry(c)
+			handler := r.Handler()
+
+			serve := func(method string, path string, body string, roles ...string) *httptest.ResponseRecorder {
+				request := httptest.NewRequest(method, path, strings.NewReader(body))
+				if len(roles) > 0 {
+					request = request.WithContext(context.WithValue(request.Context(), kctx.UserRolesKey, roles))
+				}
+				recorder := httptest.NewRecorder()
+				handler.ServeHTTP(recorder, request)
+				return recorder
+			}
+
+			app := `{"address": "orders", "element": "orders-app", "path": "/app.js", "targets": [{"path": "/orders"}]}`
+
+			assert.Equal(t, http.StatusForbidden, serve("GET", "/~/registry/apps", "").Code)
+			assert.Equal(t, http.StatusForbidden, serve("PUT", "/~/registry/apps/orders", app, "viewer").Code)
+			recorder := serve("PUT", "/~/registry/apps/static", app, "admin")
+			assert.Equal(t, http.StatusConflict, recorder.Code)
+			assert.JSONEq(t, `{"error": "app static is configured statically"}`, recorder.Body.String())
+			assert.Equal(t, http.StatusBadRequest, serve("PUT", "/~/registry/apps/orders", `{"address": "orders"}`, "admin").Code)
+			assert.Equal(t, http.StatusBadRequest, serve("PUT", "/~/registry/apps/orders@canary", app, "admin").Code)
+			assert.Equal(t, http.StatusBadRequest, serve("PUT", "/~/registry/apps/orders%2Fv2", app, "admin").Code)
+			assert.Equal(t, http.StatusBadRequest, serve("GET", "/~/registry/apps/orders@canary", "", "viewer").Code)
+			assert.Equal(t, http.StatusBadRequest, serve("DELETE", "/~/registry/apps/orders%2Fv2", "", "admin").Code)
+			assert.Equal(t, http.StatusBadRequest, serve("PUT", "/~/registry/apps/orders", `{"alias": "other", "address": "orders", "element": "orders-app", "path": "/app.js", "targets": [{"path": "/orders"}]}`, "admin").Code)
+
+			recorder = serve("PUT", "/~/registry/apps/orders", app, "admin")
+			assert.Equal(t, http.StatusCreated, recorder.Code)
+			assert.Contains(t, recorder.Body.String(), `"alias":"orders"`)
+
+			apps := c.GetAppsForTargetPath("/orders")
+			assert.Len(t, apps, 1)
+			assert.Equal(t, "orders-app", apps[0].Element)
+
+			updated := strings.Replace(app, "orders-app", "orders-app-v2", 1)
+			assert.Equal(t, http.StatusOK, serve("PUT", "/~/registry/apps/orders", updated, "admin").Code)
+			apps = c.GetAppsForTargetPath("/orders")
+			assert.Equal(t, "orders-app-v2", apps[0].Element)
+
+			recorder = serve("GET", "/~/registry/apps", "", "viewer")
+			assert.Equal(t, http.StatusOK, recorder.Code)
+			assert.Contains(t, recorder.Body.String(), `"element":"orders-app-v2"`)
+			assert.NotContains(t, recorder.Body.String(), `"static"`)
+
+			assert.Equal(t, http.StatusOK, serve("GET", "/~/registry/apps/orders", "", "viewer").Code)
+			assert.Equal(t, http.StatusNotFound, serve("GET", "/~/registry/apps/missing", "", "viewer").Code)
+
+			assert.Equal(t, http.StatusNoContent, serve("DELETE", "/~/registry/apps/orders", "", "admin").Code)
+			assert.Equal(t, http.StatusNotFound, serve("DELETE", "/~/registry/apps/orders", "", "admin").Code)
+			assert.Empty(t, c.GetAppsForTargetPath("/orders"))
+
+			_, ok := c.GetAppByAlias("static")
+			assert.True(t, ok)
+		})
+	}
+}
+
+func TestRegistry_Apps_refresh(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "apps.json")
+	newConfig := func() *config.Config {
+		return &config.Config{
+			Registry: config.RegistryConfig{Enabled: true, Endpoint: "/~/registry/apps", File: file, Refresh: 1, Store: "file"},
+		}
+	}
+
+	writer := NewRegistry(newConfig())
+	reader := NewRegistry(newConfig())
+	assert.Empty(t, reader.Apps())
+
+	app := config.App{Address: "orders", Alias: "orders", Element: "orders-app", Path: "/app.js", Targets: []config.Target{{Path: "/orders"}}}
+	created, err := writer.Store.Set(context.Background(), app)
+	assert.NoError(t, err)
+	assert.True(t, created)
+
+	assert.Equal(t, []config.App{app}, reader.Apps())
+}
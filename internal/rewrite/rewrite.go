@@ -0,0 +1,213 @@
+// Copyright 2025 KDex Tech
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rewrite
+
+import (
+	"net"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+
+	"kdex.dev/proxy/internal/config"
+	kctx "kdex.dev/proxy/internal/context"
+)
+
+// Rewriter maps URLs pointing at the upstream origin (and below the
+// upstream prefix) back onto the public origin the client used.
+type Rewriter struct {
+	Config *config.Config
+}
+
+func NewRewriter(config *config.Config) *Rewriter {
+	return &Rewriter{
+		Config: config,
+	}
+}
+
+// RewriteResponse rewrites the configured headers and the Set-Cookie headers
+// of an upstream response.
+func (rw *Rewriter) RewriteResponse(r *http.Response) {
+	if !rw.Config.Proxy.Rewrite.Enabled || r.Request == nil {
+		return
+	}
+
+	origin, ok := r.Request.Context().Value(kctx.PublicOriginKey).(kctx.PublicOrigin)
+	if !ok {
+		return
+	}
+
+	for _, header := range rw.Config.Proxy.Rewrite.Headers {
+		value := r.Header.Get(header)
+		if value == "" {
+			continue
+		}
+
+		if http.CanonicalHeaderKey(header) == "Refresh" {
+			r.Header.Set(header, rw.rewriteRefresh(origin, value))
+		} else {
+			r.Header.Set(header, rw.RewriteURL(origin, value))
+		}
+	}
+
+	if rw.Config.Proxy.Rewrite.Cookies {
+		cookies := r.Header.Values("Set-Cookie")
+		if len(cookies) == 0 {
+			return
+		}
+
+		r.Header.Del("Set-Cookie")
+		for _, value := range cookies {
+			r.Header.Add("Set-Cookie", rw.rewriteCookie(value))
+		}
+	}
+}
+
+// RewriteURL returns rawURL with the upstream origin replaced by the public
+// origin and the upstream prefix stripped from the path. URLs which do not
+// point at the upstream are returned unchanged.
+func (rw *Rewriter) RewriteURL(origin kctx.PublicOrigin, rawURL string) string {
+	trimmed := strings.TrimSpace(rawURL)
+	if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+		return rawURL
+	}
+
+	u, err := url.Parse(trimmed)
+	if err != nil {
+		return rawURL
+	}
+
+	switch {
+	case u.Host != "":
+		if u.Scheme != "" && u.Scheme != "http" && u.Scheme != "https" {
+			return rawURL
+		}
+		if !rw.isUpstreamHost(u.Scheme, u.Host) {
+			return rawURL
+		}
+		if u.Scheme != "" {
+			u.Scheme = origin.Scheme
+		}
+		u.Host = origin.Host
+	case u.Scheme != "":
+		// mailto:, data:, javascript: and friends
+		return rawURL
+	case !strings.HasPrefix(u.Path, "/"):
+		// relative references resolve against the public URL already
+		return rawURL
+	}
+
+	u.Path, u.RawPath = rw.stripPrefix(u.Path), rw.stripPrefix(u.RawPath)
+
+	return u.String()
+}
+
+func (rw *Rewriter) upstreamHosts() []string {
+	hosts := []string{rw.Config.Proxy.UpstreamAddress}
+	if rw.Config.Proxy.Canary.Address != "" {
+		hosts = append(hosts, rw.Config.Proxy.Canary.Address)
+	}
+	return append(hosts, rw.Config.Proxy.Rewrite.UpstreamHosts...)
+}
+
+func (rw *Rewriter) isUpstreamHost(scheme string, host string) bool {
+	hosts := rw.upstreamHosts()
+
+	if slices.Contains(hosts, host) {
+		return true
+	}
+
+	// A URL may omit the default port the upstream address spells out and
+	// vice versa.
+	return slices.Contains(hosts, withDefaultPort(scheme, host)) ||
+		slices.ContainsFunc(hosts, func(h string) bool {
+			return withDefaultPort(scheme, h) == host
+		})
+}
+
+func (rw *Rewriter) rewriteCookie(value string) string {
+	cookie, err := http.ParseSetCookie(value)
+	if err != nil {
+		return value
+	}
+
+	if cookie.Domain != "" {
+		domain := strings.TrimPrefix(cookie.Domain, ".")
+		if rw.isUpstreamDomain(domain) {
+			// A host-only cookie is bound to whatever host the client used,
+			// which is the public host.
+			cookie.Domain = ""
+		}
+	}
+
+	if cookie.Path != "" {
+		cookie.Path = rw.stripPrefix(cookie.Path)
+	}
+
+	return cookie.String()
+}
+
+func (rw *Rewriter) isUpstreamDomain(domain string) bool {
+	for _, host := range rw.upstreamHosts() {
+		if hostname(host) == domain {
+			return true
+		}
+	}
+	return false
+}
+
+func (rw *Rewriter) rewriteRefresh(origin kctx.PublicOrigin, value string) string {
+	idx := strings.Index(strings.ToLower(value), "url=")
+	if idx == -1 {
+		return value
+	}
+
+	target := strings.Trim(value[idx+4:], `'" `)
+	return value[:idx+4] + rw.RewriteURL(origin, target)
+}
+
+func (rw *Rewriter) stripPrefix(path string) string {
+	prefix := strings.TrimSuffix(rw.Config.Proxy.UpstreamPrefix, "/")
+	if prefix == "" || path == "" {
+		return path
+	}
+
+	if path == prefix {
+		return "/"
+	}
+
+	if strings.HasPrefix(path, prefix+"/") {
+		return strings.TrimPrefix(path, prefix)
+	}
+
+	return path
+}
+
+func hostname(host string) string {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		return h
+	}
+	return host
+}
+
+func withDefaultPort(scheme string, host string) string {
+	if _, _, err := net.SplitHostPort(host); err == nil {
+		return host
+	}
+	if scheme == "https" {
+		return host + ":443"
+	}
+	return host + ":80"
+}
@@ -0,0 +1,154 @@
+// Copyright 2025 KDex Tech
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rewrite
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"kdex.dev/proxy/internal/config"
+	kctx "kdex.dev/proxy/internal/context"
+	"kdex.dev/proxy/internal/util"
+)
+
+func testConfig() *config.Config {
+	c := *config.DefaultConfig()
+	c.Proxy.UpstreamAddress = "upstream:8080"
+	c.Proxy.UpstreamPrefix = "/site"
+	c.Proxy.Rewrite = config.RewriteConfig{
+		Attributes:    []string{"href", "src", "action", "srcset"},
+		Cookies:       true,
+		Enabled:       true,
+		Headers:       []string{"Location", "Content-Location", "Refresh"},
+		UpstreamHosts: []string{"upstream.internal"},
+	}
+	return &c
+}
+
+func testResponse(header http.Header) *http.Response {
+	req := httptest.NewRequest("GET", "/", nil)
+	req = req.WithContext(context.WithValue(req.Context(), kctx.PublicOriginKey, kctx.PublicOrigin{
+		Host:   "www.example.com",
+		Scheme: "https",
+	}))
+	return &http.Response{
+		Header:  header,
+		Request: req,
+	}
+}
+
+func TestRewriter_RewriteURL(t *testing.T) {
+	rw := NewRewriter(testConfig())
+	origin := kctx.PublicOrigin{Host: "www.example.com", Scheme: "https"}
+
+	tests := []struct {
+		name string
+		url  string
+		want string
+	}{
+		{name: "upstream origin", url: "http://upstream:8080/site/about/", want: "https://www.example.com/about/"},
+		{name: "upstream origin with query", url: "http://upstream:8080/site/a?b=c#d", want: "https://www.example.com/a?b=c#d"},
+		{name: "upstream prefix root", url: "http://upstream:8080/site", want: "https://www.example.com/"},
+		{name: "upstream alias with default port", url: "http://upstream.internal/site/x", want: "https://www.example.com/x"},
+		{name: "protocol relative", url: "//upstream:8080/site/x", want: "//www.example.com/x"},
+		{name: "root relative", url: "/site/x", want: "/x"},
+		{name: "root relative outside prefix", url: "/sitemap.xml", want: "/sitemap.xml"},
+		{name: "relative", url: "x/y", want: "x/y"},
+		{name: "fragment", url: "#top", want: "#top"},
+		{name: "foreign host", url: "https://cdn.example.org/site/x.js", want: "https://cdn.example.org/site/x.js"},
+		{name: "mailto", url: "mailto:someone@upstream", want: "mailto:someone@upstream"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, rw.RewriteURL(origin, tt.url))
+		})
+	}
+}
+
+func TestRewriter_RewriteResponse(t *testing.T) {
+	tests := []struct {
+		name   string
+		header http.Header
+		want   http.Header
+	}{
+		{
+			name: "location",
+			header: http.Header{
+				"Location": {"http://upstream:8080/site/login"},
+			},
+			want: http.Header{
+				"Location": {"https://www.example.com/login"},
+			},
+		},
+		{
+			name: "content location and refresh",
+			header: http.Header{
+				"Content-Location": {"/site/index.html"},
+				"Refresh":          {"5; url=http://upstream:8080/site/next"},
+			},
+			want: http.Header{
+				"Content-Location": {"/index.html"},
+				"Refresh":          {"5; url=https://www.example.com/next"},
+			},
+		},
+		{
+			name: "cookies",
+			header: http.Header{
+				"Set-Cookie": {
+					"a=1; Domain=upstream; Path=/site/app",
+					"b=2; Domain=example.org; Path=/other",
+				},
+			},
+			want: http.Header{
+				"Set-Cookie": {
+					"a=1; Path=/app",
+					"b=2; Path=/other; Domain=example.org",
+				},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := testResponse(tt.header)
+			NewRewriter(testConfig()).RewriteResponse(r)
+			assert.Equal(t, tt.want, r.Header)
+		})
+	}
+}
+
+func TestRewriteTransformer_Transform(t *testing.T) {
+	tests := []struct {
+		name string
+		doc  string
+		want string
+	}{
+		{
+			name: "attributes",
+			doc:  `<a href="http://upstream:8080/site/a">a</a><img src="/site/i.png" srcset="/site/i.png 1x, http://upstream:8080/site/i2.png 2x"/><form action="/site/post"></form><a href="https://other/site/a">b</a>`,
+			want: `<html><head></head><body><a href="https://www.example.com/a">a</a><img src="/i.png" srcset="/i.png 1x, https://www.example.com/i2.png 2x"/><form action="/post"></form><a href="https://other/site/a">b</a></body></html>`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc := util.ToDoc(tt.doc)
+			err := NewRewriteTransformer(testConfig()).Transform(testResponse(http.Header{}), doc)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, util.FromDoc(doc))
+		})
+	}
+}
@@ -0,0 +1,86 @@
+// Copyright 2025 KDex Tech
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rewrite
+
+import (
+	"net/http"
+	"slices"
+	"strings"
+
+	"golang.org/x/net/html"
+	"kdex.dev/proxy/internal/config"
+	kctx "kdex.dev/proxy/internal/context"
+	"kdex.dev/proxy/internal/transform"
+)
+
+type RewriteTransformer struct {
+	transform.Transformer
+	Config   *config.Config
+	Rewriter *Rewriter
+}
+
+func NewRewriteTransformer(config *config.Config) *RewriteTransformer {
+	return &RewriteTransformer{
+		Config:   config,
+		Rewriter: NewRewriter(config),
+	}
+}
+
+func (t *RewriteTransformer) Transform(r *http.Response, doc *html.Node) error {
+	if !t.Config.Proxy.Rewrite.Enabled || len(t.Config.Proxy.Rewrite.Attributes) == 0 {
+		return nil
+	}
+
+	origin, ok := r.Request.Context().Value(kctx.PublicOriginKey).(kctx.PublicOrigin)
+	if !ok {
+		return nil
+	}
+
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode {
+			for i, a := range n.Attr {
+				if a.Namespace != "" || !slices.Contains(t.Config.Proxy.Rewrite.Attributes, a.Key) {
+					continue
+				}
+
+				if a.Key == "srcset" {
+					n.Attr[i].Val = t.rewriteSrcset(origin, a.Val)
+				} else {
+					n.Attr[i].Val = t.Rewriter.RewriteURL(origin, a.Val)
+				}
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(doc)
+
+	return nil
+}
+
+func (t *RewriteTransformer) rewriteSrcset(origin kctx.PublicOrigin, srcset string) string {
+	candidates := strings.Split(srcset, ",")
+	for i, candidate := range candidates {
+		fields := strings.Fields(candidate)
+		if len(fields) == 0 {
+			continue
+		}
+		fields[0] = t.Rewriter.RewriteURL(origin, fields[0])
+		candidates[i] = strings.Join(fields, " ")
+	}
+	return strings.Join(candidates, ", ")
+}
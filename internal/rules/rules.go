@@ -0,0 +1,291 @@
+// Copyright 2025 KDex Tech
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rules
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/andybalholm/cascadia"
+	"github.com/antchfx/htmlquery"
+	"github.com/antchfx/xpath"
+	"golang.org/x/net/html"
+	"kdex.dev/proxy/internal/config"
+	kctx "kdex.dev/proxy/internal/context"
+	"kdex.dev/proxy/internal/dom"
+	"kdex.dev/proxy/internal/expression"
+	"kdex.dev/proxy/internal/store/session"
+	"kdex.dev/proxy/internal/transform"
+	"kdex.dev/proxy/internal/util"
+)
+
+const (
+	ActionAddClass        = "add_class"
+	ActionAppend          = "append"
+	ActionInsertAfter     = "insert_after"
+	ActionInsertBefore    = "insert_before"
+	ActionPrepend         = "prepend"
+	ActionRemove          = "remove"
+	ActionRemoveAttribute = "remove_attribute"
+	ActionReplace         = "replace"
+	ActionSetAttribute    = "set_attribute"
+	ActionSetText         = "set_text"
+)
+
+var fragmentActions = []string{ActionAppend, ActionInsertAfter, ActionInsertBefore, ActionPrepend, ActionReplace}
+
+type compiledRule struct {
+	config.Rule
+	condition *expression.Program
+	css       cascadia.Sel
+	xpath     *xpath.Expr
+}
+
+// RulesTransformer applies the configured DOM rules, in order, to every
+// transformed page.
+type RulesTransformer struct {
+	transform.Transformer
+	Evaluator *expression.Evaluator
+	rules     []compiledRule
+}
+
+func NewRulesTransformer(config *config.Config) *RulesTransformer {
+	evaluator := expression.NewEvaluator()
+
+	rules, err := compile(evaluator, config.Rules)
+	if err != nil {
+		log.Fatalf("Invalid rule: %v", err)
+	}
+
+	return &RulesTransformer{
+		Evaluator: evaluator,
+		rules:     rules,
+	}
+}
+
+// compile validates the rules and compiles their selectors and conditions.
+func compile(evaluator *expression.Evaluator, rules []config.Rule) ([]compiledRule, error) {
+	compiled := make([]compiledRule, 0, len(rules))
+
+	for i, rule := range rules {
+		c := compiledRule{Rule: rule}
+
+		switch {
+		case rule.Selector != "" && rule.XPath != "":
+			return nil, fmt.Errorf("rule %d: only one of selector and xpath may be set", i)
+		case rule.Selector != "":
+			sel, err := cascadia.Parse(rule.Selector)
+			if err != nil {
+				return nil, fmt.Errorf("rule %d: invalid selector %q: %w", i, rule.Selector, err)
+			}
+			c.css = sel
+		case rule.XPath != "":
+			expr, err := xpath.Compile(rule.XPath)
+			if err != nil {
+				return nil, fmt.Errorf("rule %d: invalid xpath %q: %w", i, rule.XPath, err)
+			}
+			c.xpath = expr
+		default:
+			return nil, fmt.Errorf("rule %d: selector or xpath is required", i)
+		}
+
+		if rule.Condition != "" {
+			program, err := evaluator.Compile(rule.Condition)
+			if err != nil {
+				return nil, fmt.Errorf("rule %d: invalid condition %q: %w", i, rule.Condition, err)
+			}
+			c.condition = program
+		}
+
+		switch rule.Action {
+		case ActionAppend, ActionInsertAfter, ActionInsertBefore, ActionPrepend, ActionReplace:
+			if rule.Fragment == "" && rule.Action != ActionReplace {
+				return nil, fmt.Errorf("rule %d: action %s requires a fragment", i, rule.Action)
+			}
+		case ActionSetAttribute, ActionRemoveAttribute:
+			if rule.Attribute == "" {
+				return nil, fmt.Errorf("rule %d: action %s requires an attribute", i, rule.Action)
+			}
+		case ActionAddClass:
+			if rule.Value == "" {
+				return nil, fmt.Errorf("rule %d: action %s requires a value", i, rule.Action)
+			}
+		case ActionRemove, ActionSetText:
+		default:
+			return nil, fmt.Errorf("rule %d: unknown action %q", i, rule.Action)
+		}
+
+		compiled = append(compiled, c)
+	}
+
+	return compiled, nil
+}
+
+func (t *RulesTransformer) Transform(r *http.Response, doc *html.Node) error {
+	if len(t.rules) == 0 {
+		return nil
+	}
+
+	path, ok := r.Request.Context().Value(kctx.RequestPathKey).(string)
+	if !ok {
+		path = r.Request.URL.Path
+	}
+
+	for i, rule := range t.rules {
+		if !matchesPath(rule.Paths, path) {
+			continue
+		}
+
+		if rule.condition != nil {
+			matched, err := evaluateCondition(r.Request, rule.condition)
+			if err != nil {
+				return fmt.Errorf("error evaluating condition of rule %d: %w", i, err)
+			}
+			if !matched {
+				continue
+			}
+		}
+
+		var nodes []*html.Node
+		if rule.xpath != nil {
+			nodes = htmlquery.QuerySelectorAll(doc, rule.xpath)
+		} else {
+			nodes = cascadia.QueryAll(doc, rule.css)
+		}
+
+		for _, node := range nodes {
+			if err := apply(rule.Rule, node); err != nil {
+				return fmt.Errorf("error applying rule %d: %w", i, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+func evaluateCondition(r *http.Request, condition *expression.Program) (bool, error) {
+	data := map[string]interface{}{}
+	if sessionData, ok := r.Context().Value(kctx.SessionDataKey).(*session.SessionData); ok && sessionData != nil {
+		data = sessionData.Data
+	}
+
+	result, err := condition.EvaluateWith(map[string]interface{}{
+		"data":    data,
+		"request": expression.RequestData(r),
+	})
+	if err != nil {
+		return false, err
+	}
+
+	matched, ok := result.(bool)
+	if !ok {
+		return false, fmt.Errorf("condition must evaluate to a bool; got %T", result)
+	}
+
+	return matched, nil
+}
+
+func apply(rule config.Rule, node *html.Node) error {
+	var fragment []*html.Node
+	if slices.Contains(fragmentActions, rule.Action) && rule.Fragment != "" {
+		context := node
+		if (rule.Action != ActionAppend && rule.Action != ActionPrepend) && node.Parent != nil {
+			context = node.Parent
+		}
+
+		var err error
+		fragment, err = html.ParseFragment(strings.NewReader(rule.Fragment), context)
+		if err != nil {
+			return fmt.Errorf("error parsing fragment: %w", err)
+		}
+	}
+
+	switch rule.Action {
+	case ActionAppend:
+		for _, n := range fragment {
+			node.AppendChild(n)
+		}
+	case ActionPrepend:
+		first := node.FirstChild
+		for _, n := range fragment {
+			node.InsertBefore(n, first)
+		}
+	case ActionInsertBefore:
+		if node.Parent == nil {
+			return nil
+		}
+		for _, n := range fragment {
+			node.Parent.InsertBefore(n, node)
+		}
+	case ActionInsertAfter:
+		if node.Parent == nil {
+			return nil
+		}
+		next := node.NextSibling
+		for _, n := range fragment {
+			node.Parent.InsertBefore(n, next)
+		}
+	case ActionReplace:
+		if node.Parent == nil {
+			return nil
+		}
+		for _, n := range fragment {
+			node.Parent.InsertBefore(n, node)
+		}
+		node.Parent.RemoveChild(node)
+	case ActionRemove:
+		if node.Parent != nil {
+			node.Parent.RemoveChild(node)
+		}
+	case ActionSetAttribute:
+		dom.SetAttribute(node, rule.Attribute, rule.Value)
+	case ActionRemoveAttribute:
+		node.Attr = slices.DeleteFunc(node.Attr, func(a html.Attribute) bool {
+			return a.Namespace == "" && a.Key == rule.Attribute
+		})
+	case ActionAddClass:
+		classes := strings.Fields(dom.GetAttribute(node, "class"))
+		for _, class := range strings.Fields(rule.Value) {
+			if !slices.Contains(classes, class) {
+				classes = append(classes, class)
+			}
+		}
+		dom.SetAttribute(node, "class", strings.Join(classes, " "))
+	case ActionSetText:
+		for c := node.FirstChild; c != nil; {
+			next := c.NextSibling
+			node.RemoveChild(c)
+			c = next
+		}
+		node.AppendChild(&html.Node{Type: html.TextNode, Data: rule.Value})
+	}
+
+	return nil
+}
+
+func matchesPath(patterns []string, path string) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+	for _, pattern := range patterns {
+		if util.MatchPath(pattern, path) {
+			return true
+		}
+	}
+	return false
+}
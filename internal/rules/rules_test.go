@@ -0,0 +1,166 @@
+// Copyright 2025 KDex Tech
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rules
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"kdex.dev/proxy/internal/config"
+	kctx "kdex.dev/proxy/internal/context"
+	"kdex.dev/proxy/internal/expression"
+	"kdex.dev/proxy/internal/store/session"
+	"kdex.dev/proxy/internal/util"
+)
+
+func TestRulesTransformer_Transform(t *testing.T) {
+	tests := []struct {
+		name    string
+		rules   []config.Rule
+		path    string
+		session *session.SessionData
+		doc     string
+		want    string
+		wantErr bool
+	}{
+		{
+			name: "insert fragments",
+			rules: []config.Rule{
+				{Selector: "main", Action: ActionPrepend, Fragment: `<h1>Title</h1>`},
+				{Selector: "main", Action: ActionAppend, Fragment: `<footer>End</footer>`},
+				{Selector: "p", Action: ActionInsertBefore, Fragment: `<hr/>`},
+				{XPath: "//p", Action: ActionInsertAfter, Fragment: `<br/>`},
+			},
+			doc:  `<main><p>a</p></main>`,
+			want: `<html><head></head><body><main><h1>Title</h1><hr/><p>a</p><br/><footer>End</footer></main></body></html>`,
+		},
+		{
+			name: "replace and remove",
+			rules: []config.Rule{
+				{Selector: ".ad", Action: ActionRemove},
+				{Selector: "#old", Action: ActionReplace, Fragment: `<span>new</span>`},
+			},
+			doc:  `<div class="ad">x</div><div id="old">old</div><div class="ad">y</div>`,
+			want: `<html><head></head><body><span>new</span></body></html>`,
+		},
+		{
+			name: "attributes, classes and text",
+			rules: []config.Rule{
+				{Selector: "a", Action: ActionSetAttribute, Attribute: "rel", Value: "noopener"},
+				{Selector: "a", Action: ActionRemoveAttribute, Attribute: "target"},
+				{Selector: "a", Action: ActionAddClass, Value: "link active"},
+				{Selector: "a", Action: ActionSetText, Value: "<Home>"},
+			},
+			doc:  `<a href="/" target="_blank" class="link">home</a>`,
+			want: `<html><head></head><body><a href="/" class="link active" rel="noopener">&lt;Home&gt;</a></body></html>`,
+		},
+		{
+			name: "path not matching",
+			rules: []config.Rule{
+				{Selector: "p", Action: ActionRemove, Paths: []string{"/blog/*"}},
+			},
+			path: "/about",
+			doc:  `<p>a</p>`,
+			want: `<html><head></head><body><p>a</p></body></html>`,
+		},
+		{
+			name: "path matching",
+			rules: []config.Rule{
+				{Selector: "p", Action: ActionRemove, Paths: []string{"/blog/*"}},
+			},
+			path: "/blog/post",
+			doc:  `<p>a</p>`,
+			want: `<html><head></head><body></body></html>`,
+		},
+		{
+			name: "condition over claims and request",
+			rules: []config.Rule{
+				{Selector: "p", Action: ActionSetText, Value: "admin", Condition: `"admin" in data.roles && request.path == "/"`},
+				{Selector: "p", Action: ActionAddClass, Value: "hidden", Condition: `"guest" in data.roles`},
+			},
+			path: "/",
+			session: &session.SessionData{
+				Data: map[string]interface{}{"roles": []string{"admin"}},
+			},
+			doc:  `<p>a</p>`,
+			want: `<html><head></head><body><p>admin</p></body></html>`,
+		},
+		{
+			name: "condition not a bool",
+			rules: []config.Rule{
+				{Selector: "p", Action: ActionRemove, Condition: `"x"`},
+			},
+			doc:     `<p>a</p>`,
+			want:    `<html><head></head><body><p>a</p></body></html>`,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rules, err := compile(expression.NewEvaluator(), tt.rules)
+			assert.NoError(t, err)
+
+			tr := &RulesTransformer{
+				Evaluator: expression.NewEvaluator(),
+				rules:     rules,
+			}
+
+			rec := httptest.NewRecorder()
+			res := rec.Result()
+			res.Request = httptest.NewRequest("GET", "/upstream", nil)
+			ctx := res.Request.Context()
+			if tt.path != "" {
+				ctx = context.WithValue(ctx, kctx.RequestPathKey, tt.path)
+			}
+			if tt.session != nil {
+				ctx = context.WithValue(ctx, kctx.SessionDataKey, tt.session)
+			}
+			res.Request = res.Request.WithContext(ctx)
+
+			doc := util.ToDoc(tt.doc)
+			err = tr.Transform(res, doc)
+			assert.Equal(t, tt.wantErr, err != nil)
+			assert.Equal(t, tt.want, util.FromDoc(doc))
+		})
+	}
+}
+
+func Test_compile(t *testing.T) {
+	tests := []struct {
+		name    string
+		rule    config.Rule
+		wantErr bool
+	}{
+		{name: "valid", rule: config.Rule{Selector: "p", Action: ActionRemove}},
+		{name: "no selector", rule: config.Rule{Action: ActionRemove}, wantErr: true},
+		{name: "selector and xpath", rule: config.Rule{Selector: "p", XPath: "//p", Action: ActionRemove}, wantErr: true},
+		{name: "invalid selector", rule: config.Rule{Selector: "p[", Action: ActionRemove}, wantErr: true},
+		{name: "invalid xpath", rule: config.Rule{XPath: "//p[", Action: ActionRemove}, wantErr: true},
+		{name: "unknown action", rule: config.Rule{Selector: "p", Action: "explode"}, wantErr: true},
+		{name: "missing fragment", rule: config.Rule{Selector: "p", Action: ActionAppend}, wantErr: true},
+		{name: "missing attribute", rule: config.Rule{Selector: "p", Action: ActionSetAttribute}, wantErr: true},
+		{name: "valid condition", rule: config.Rule{Selector: "p", Action: ActionRemove, Condition: `"admin" in data.roles`}},
+		{name: "invalid condition", rule: config.Rule{Selector: "p", Action: ActionRemove, Condition: `"admin" in data.roles &&`}, wantErr: true},
+		{name: "undeclared variable in condition", rule: config.Rule{Selector: "p", Action: ActionRemove, Condition: `user.admin`}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := compile(expression.NewEvaluator(), []config.Rule{tt.rule})
+			assert.Equal(t, tt.wantErr, err != nil)
+		})
+	}
+}
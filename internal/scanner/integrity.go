@@ -0,0 +1,235 @@
+// Copyright 2025 KDex Tech
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scanner
+
+import (
+	"context"
+	"crypto/sha512"
+	"encoding/base64"
+	"fmt"
+	"hash/crc32"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+var moduleExtensions = []string{".js", ".mjs"}
+
+// Integrity computes SHA-384 subresource integrity for the modules in a
+// module dir. The modules are scanned in the background every refresh
+// interval, and only files that changed are hashed again; requests read the
+// result of the last scan.
+type Integrity struct {
+	ModuleDir string
+	Refresh   time.Duration
+	cancel    context.CancelFunc
+	digest    string
+	files     map[string]fileIntegrity // By path relative to the module dir; replaced by each scan
+	modules   map[string]string
+	mu        sync.RWMutex
+	scanned   bool
+	scanning  sync.Mutex
+}
+
+type fileIntegrity struct {
+	hash    string
+	modTime time.Time
+	size    int64
+}
+
+func NewIntegrity(moduleDir string, refresh time.Duration) *Integrity {
+	return &Integrity{
+		ModuleDir: moduleDir,
+		Refresh:   refresh,
+		files:     make(map[string]fileIntegrity),
+		modules:   make(map[string]string),
+	}
+}
+
+// Start scans the modules now and then every refresh interval, until Stop is
+// called or the context is done.
+func (i *Integrity) Start(ctx context.Context) {
+	ctx, i.cancel = context.WithCancel(ctx)
+
+	go func() {
+		i.Scan()
+		if i.Refresh <= 0 {
+			return
+		}
+
+		ticker := time.NewTicker(i.Refresh)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				i.Scan()
+			}
+		}
+	}()
+}
+
+// Stop stops scanning the modules.
+func (i *Integrity) Stop() {
+	if i.cancel != nil {
+		i.cancel()
+	}
+}
+
+// Modules returns the integrity of every module in the module dir, by path
+// relative to the module dir, as of the last scan. The map must not be
+// modified.
+func (i *Integrity) Modules() map[string]string {
+	i.load()
+
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+	return i.modules
+}
+
+// Digest identifies the integrity returned by Modules, so pages embedding it
+// can be told apart once modules change.
+func (i *Integrity) Digest() string {
+	i.load()
+
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+	return i.digest
+}
+
+// File returns the integrity of a file relative to the module dir, or false
+// when there is no such file. Files the last scan didn't hash are hashed on
+// demand.
+func (i *Integrity) File(path string) (string, bool) {
+	path = filepath.Clean(path)
+
+	i.load()
+
+	i.mu.RLock()
+	file, ok := i.files[path]
+	i.mu.RUnlock()
+	if ok {
+		return file.hash, true
+	}
+
+	content, err := os.ReadFile(filepath.Join(i.ModuleDir, path))
+	if err != nil {
+		return "", false
+	}
+	return Hash(content), true
+}
+
+// Scan hashes the modules that changed since the last scan and publishes
+// the result. Nothing is locked for readers while files are hashed.
+func (i *Integrity) Scan() {
+	i.scanning.Lock()
+	defer i.scanning.Unlock()
+
+	i.mu.RLock()
+	previous := i.files
+	i.mu.RUnlock()
+
+	files := make(map[string]fileIntegrity, len(previous))
+
+	err := filepath.WalkDir(i.ModuleDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || !isModule(path) {
+			return err
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(i.ModuleDir, path)
+		if err != nil {
+			return err
+		}
+
+		if file, ok := previous[rel]; ok && file.modTime.Equal(info.ModTime()) && file.size == info.Size() {
+			files[rel] = file
+			return nil
+		}
+
+		content, err := os.ReadFile(path)
+		if err != nil {
+			log.Printf("Error hashing %s: %v", rel, err)
+			return nil
+		}
+		files[rel] = fileIntegrity{
+			hash:    Hash(content),
+			modTime: info.ModTime(),
+			size:    info.Size(),
+		}
+		return nil
+	})
+	if err != nil {
+		log.Printf("Error scanning %s for integrity: %v", i.ModuleDir, err)
+	}
+
+	modules := make(map[string]string, len(files))
+	paths := make([]string, 0, len(files))
+	for path, file := range files {
+		modules[path] = file.hash
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	digest := crc32.NewIEEE()
+	for _, path := range paths {
+		fmt.Fprintf(digest, "%s %s\n", path, modules[path])
+	}
+
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.digest = fmt.Sprintf("%x", digest.Sum32())
+	i.files = files
+	i.modules = modules
+	i.scanned = true
+}
+
+// load scans the modules when they haven't been yet, so the first requests
+// get their integrity before the background scan completes.
+func (i *Integrity) load() {
+	i.mu.RLock()
+	scanned := i.scanned
+	i.mu.RUnlock()
+
+	if !scanned {
+		i.Scan()
+	}
+}
+
+// Hash returns the SHA-384 subresource integrity of the content.
+func Hash(content []byte) string {
+	sum := sha512.Sum384(content)
+	return "sha384-" + base64.StdEncoding.EncodeToString(sum[:])
+}
+
+func isModule(path string) bool {
+	for _, extension := range moduleExtensions {
+		if strings.HasSuffix(path, extension) {
+			return true
+		}
+	}
+	return false
+}
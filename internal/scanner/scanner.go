@@ -21,6 +21,7 @@ import (
 	"os"
 	"path/filepath"
 	"regexp"
+	"slices"
 	"strings"
 )
 
@@ -50,6 +51,7 @@ type PackageJSON struct {
 
 type Scanner struct {
 	ModuleDir string
+	Exclude   []string // Directories skipped while scanning, such as the module dirs of apps
 	Imports   map[string]string
 	Scanned   map[string]bool
 }
@@ -69,6 +71,25 @@ func (s *Scanner) ScanRootDir() error {
 	return nil
 }
 
+// ScanAppDir scans the dependencies declared in the package.json at the root
+// of the module dir, or every package in it when there is none.
+func (s *Scanner) ScanAppDir() error {
+	pkgData, err := os.ReadFile(filepath.Join(s.ModuleDir, "package.json"))
+	if os.IsNotExist(err) {
+		return s.ScanRootDir()
+	}
+	if err != nil {
+		return fmt.Errorf("reading package.json: %w", err)
+	}
+
+	var pkg PackageJSON
+	if err := json.Unmarshal(pkgData, &pkg); err != nil {
+		return fmt.Errorf("parsing package.json: %w", err)
+	}
+
+	return s.ScanDependencies(pkg.Dependencies)
+}
+
 func (s *Scanner) ScanDependencies(dependencies PackageDependencies) error {
 	for pkgName := range dependencies {
 		if err := s.ScanPackage(pkgName); err != nil {
@@ -88,7 +109,7 @@ func NewScanner(moduleDir string) *Scanner {
 }
 
 func (s *Scanner) ScanPackage(packageName string) error {
-	if s.Scanned[packageName] {
+	if s.Scanned[packageName] || slices.Contains(s.Exclude, packageName) {
 		return nil
 	}
 
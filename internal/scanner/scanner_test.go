@@ -15,8 +15,14 @@
 package scanner
 
 import (
+	"context"
+	"os"
+	"path/filepath"
 	"reflect"
 	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
 )
 
 func TestScanner_ScanRootDir(t *testing.T) {
@@ -215,3 +221,27 @@ func TestScanner_LoadImports(t *testing.T) {
 		})
 	}
 }
+
+func TestIntegrity_Start(t *testing.T) {
+	moduleDir := t.TempDir()
+	module := filepath.Join(moduleDir, "index.js")
+	assert.NoError(t, os.WriteFile(module, []byte(`export default 1;`), 0o644))
+
+	integrity := NewIntegrity(moduleDir, 10*time.Millisecond)
+	integrity.Start(context.Background())
+	defer integrity.Stop()
+
+	assert.Equal(t, map[string]string{"index.js": Hash([]byte(`export default 1;`))}, integrity.Modules())
+	digest := integrity.Digest()
+
+	assert.NoError(t, os.WriteFile(module, []byte(`export default 2;`), 0o644))
+	assert.Eventually(t, func() bool {
+		return integrity.Modules()["index.js"] == Hash([]byte(`export default 2;`))
+	}, time.Second, 5*time.Millisecond)
+	assert.NotEqual(t, digest, integrity.Digest())
+
+	assert.NoError(t, os.Remove(module))
+	assert.Eventually(t, func() bool {
+		return len(integrity.Modules()) == 0
+	}, time.Second, 5*time.Millisecond)
+}
@@ -0,0 +1,120 @@
+// Copyright 2025 KDex Tech
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package state
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash/crc32"
+	"net/http"
+
+	"golang.org/x/net/html"
+	"kdex.dev/proxy/internal/config"
+	kctx "kdex.dev/proxy/internal/context"
+	"kdex.dev/proxy/internal/dom"
+	"kdex.dev/proxy/internal/transform"
+)
+
+// BootstrapTransformer embeds the user state in the page as a JSON script
+// element so @kdex/ui can render without fetching the state endpoint first.
+// The embedded data is the state endpoint's projection narrowed to the
+// bootstrap claims.
+type BootstrapTransformer struct {
+	transform.Transformer
+	Config  *config.StateBootstrapConfig
+	Handler *StateHandler
+}
+
+func NewBootstrapTransformer(config *config.Config) *BootstrapTransformer {
+	return &BootstrapTransformer{
+		Config:  &config.State.Bootstrap,
+		Handler: NewStateHandler(config),
+	}
+}
+
+func (t *BootstrapTransformer) Transform(r *http.Response, doc *html.Node) error {
+	headNode := dom.FindElementByName("head", doc, nil)
+	if headNode == nil {
+		return nil
+	}
+
+	payload, err := t.memoizedPayload(r.Request)
+	if err != nil {
+		return err
+	}
+
+	scriptNode := &html.Node{
+		Type: html.ElementNode,
+		Data: "script",
+		Attr: []html.Attribute{
+			{Key: "type", Val: "application/json"},
+			{Key: "id", Val: t.Config.ElementID},
+		},
+	}
+	scriptNode.AppendChild(&html.Node{Type: html.TextNode, Data: string(payload)})
+	headNode.AppendChild(scriptNode)
+
+	return nil
+}
+
+// VariantKey identifies the embedded state, so pages rendered for different
+// users get different validators.
+func (t *BootstrapTransformer) VariantKey(r *http.Request) string {
+	payload, err := t.memoizedPayload(r)
+	if err != nil {
+		return ""
+	}
+	return fmt.Sprintf("state-%x", crc32.ChecksumIEEE(payload))
+}
+
+type memoizedPayload struct {
+	payload []byte
+	err     error
+}
+
+// memoizedPayload renders the payload once per proxied request, so the
+// validator and the embedded state come from the same evaluation.
+func (t *BootstrapTransformer) memoizedPayload(r *http.Request) ([]byte, error) {
+	memo, ok := r.Context().Value(kctx.MemoKey).(*kctx.Memo)
+	if !ok {
+		return t.payload(r)
+	}
+	result := memo.Once(t, func() any {
+		payload, err := t.payload(r)
+		return memoizedPayload{payload: payload, err: err}
+	}).(memoizedPayload)
+	return result.payload, result.err
+}
+
+// payload renders the state as JSON. encoding/json escapes <, > and & so the
+// payload can't close the script element it's embedded in.
+func (t *BootstrapTransformer) payload(r *http.Request) ([]byte, error) {
+	userState := t.Handler.UserState(r)
+	userState.Data = selectClaims(userState.Data, t.Config.Claims)
+
+	if len(t.Config.Permissions) > 0 {
+		permissions, err := t.Handler.Permissions(r, t.Config.Permissions)
+		if err != nil {
+			return nil, err
+		}
+		userState.Permissions = permissions
+	}
+
+	payload, err := json.Marshal(userState)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode user state: %w", err)
+	}
+	return payload, nil
+}
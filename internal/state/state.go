@@ -16,54 +16,226 @@ package state
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
 	"log"
+	"maps"
 	"net/http"
+	"strings"
 
+	"kdex.dev/proxy/internal/check"
+	"kdex.dev/proxy/internal/config"
 	kctx "kdex.dev/proxy/internal/context"
 	"kdex.dev/proxy/internal/expression"
 	"kdex.dev/proxy/internal/store/session"
 )
 
+type PermissionResult struct {
+	Action   string `json:"action"`
+	Allowed  bool   `json:"allowed"`
+	Resource string `json:"resource"`
+}
+
 type UserState struct {
-	Principal string                 `json:"principal"`
-	Roles     []string               `json:"roles"`
-	Data      map[string]interface{} `json:"data"`
+	Principal   string                 `json:"principal"`
+	Roles       []string               `json:"roles"`
+	Data        map[string]interface{} `json:"data"`
+	Permissions []PermissionResult     `json:"permissions,omitempty"`
 }
 
 type StateHandler struct {
+	Checker        *check.Checker
+	Config         *config.StateConfig
 	FieldEvaluator *expression.FieldEvaluator
 }
 
+func NewStateHandler(config *config.Config) *StateHandler {
+	return &StateHandler{
+		Checker:        check.NewChecker(config),
+		Config:         &config.State,
+		FieldEvaluator: expression.NewFieldEvaluator(config),
+	}
+}
+
 func (h *StateHandler) StateHandler() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "application/json")
 
-		sessionData, ok := r.Context().Value(kctx.SessionDataKey).(*session.SessionData)
-		if !ok || sessionData == nil {
-			json.NewEncoder(w).Encode(UserState{
-				Principal: "",
-				Roles:     []string{},
-				Data:      map[string]interface{}{},
-			})
+		userState := h.UserState(r)
+
+		if h.Config != nil && len(h.Config.Permissions) > 0 {
+			permissions, err := h.Permissions(r, h.Config.Permissions)
+			if err != nil {
+				w.WriteHeader(http.StatusInternalServerError)
+				w.Write([]byte(fmt.Sprintf(`{"error": %q}`, err.Error())))
+				return
+			}
+			userState.Permissions = permissions
+		}
+
+		body, err := json.Marshal(userState)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte(fmt.Sprintf(`{"error": %q}`, err.Error())))
 			return
 		}
 
-		principal, err := h.FieldEvaluator.EvaluatePrincipal(sessionData.Data)
+		etag := fmt.Sprintf(`"%x"`, crc32.ChecksumIEEE(body))
+		w.Header().Set("Cache-Control", "private")
+		w.Header().Set("ETag", etag)
+		w.Header().Add("Vary", "Authorization")
+		w.Header().Add("Vary", "Cookie")
+
+		if matchesETag(r.Header.Get("If-None-Match"), etag) {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+
+		w.Write(append(body, '\n'))
+	}
+}
+
+// UserState builds the state of the user making the request from the
+// session claims, exposing only the configured projection of them.
+func (h *StateHandler) UserState(r *http.Request) UserState {
+	sessionData, ok := r.Context().Value(kctx.SessionDataKey).(*session.SessionData)
+	if !ok || sessionData == nil {
+		return UserState{
+			Principal: "",
+			Roles:     []string{},
+			Data:      map[string]interface{}{},
+		}
+	}
+
+	principal, err := h.FieldEvaluator.EvaluatePrincipal(sessionData.Data)
+	if err != nil {
+		log.Printf("error evaluating principal: %v", err)
+		principal = ""
+	}
+
+	roles, err := h.FieldEvaluator.EvaluateRoles(sessionData.Data)
+	if err != nil {
+		log.Printf("error evaluating roles: %v", err)
+		roles = []string{}
+	}
+
+	return UserState{
+		Principal: principal,
+		Roles:     roles,
+		Data:      h.project(sessionData.Data),
+	}
+}
+
+// Permissions evaluates the checks for the user making the request. Checks
+// that can't be decided are reported as not allowed.
+func (h *StateHandler) Permissions(r *http.Request, checks []config.PermissionCheck) ([]PermissionResult, error) {
+	results := make([]PermissionResult, 0, len(checks))
+	tuples := make([]check.CheckBatchTuples, 0, len(checks))
+	for _, c := range checks {
+		results = append(results, PermissionResult{Action: c.Action, Resource: c.Resource})
+		tuples = append(tuples, check.CheckBatchTuples{Action: c.Action, Resource: c.Resource})
+	}
+
+	if h.Checker == nil || h.Checker.PermissionProvider == nil {
+		return results, nil
+	}
+
+	checked, err := h.Checker.CheckBatch(r.Context(), tuples)
+	if err != nil && !errors.Is(err, check.ErrNoRoles) {
+		return nil, fmt.Errorf("failed to check permissions: %w", err)
+	}
+	for i, result := range checked {
+		results[i].Allowed = result.Allowed
+	}
+
+	return results, nil
+}
+
+func (h *StateHandler) project(claims map[string]interface{}) map[string]interface{} {
+	if h.Config == nil {
+		return claims
+	}
+
+	var data map[string]interface{}
+
+	switch {
+	case h.Config.Expression != "":
+		result, err := h.FieldEvaluator.Evaluator.EvaluateJSON(h.Config.Expression, claims)
 		if err != nil {
-			log.Printf("error evaluating principal: %v", err)
-			principal = ""
+			log.Printf("error evaluating state expression: %v", err)
 		}
+		var ok bool
+		if data, ok = result.(map[string]interface{}); !ok {
+			if err == nil {
+				log.Printf("state expression must evaluate to a map; got %T", result)
+			}
+			data = map[string]interface{}{}
+		}
+	case len(h.Config.Claims) > 0:
+		data = selectClaims(claims, h.Config.Claims)
+	default:
+		data = maps.Clone(claims)
+	}
 
-		roles, err := h.FieldEvaluator.EvaluateRoles(sessionData.Data)
+	for name, fieldExpression := range h.Config.Fields {
+		value, err := h.FieldEvaluator.Evaluator.EvaluateJSON(fieldExpression, claims)
 		if err != nil {
-			log.Printf("error evaluating roles: %v", err)
-			roles = []string{}
+			log.Printf("error evaluating state field %s: %v", name, err)
+			continue
 		}
+		data[name] = value
+	}
 
-		json.NewEncoder(w).Encode(UserState{
-			Principal: principal,
-			Roles:     roles,
-			Data:      sessionData.Data,
-		})
+	return data
+}
+
+// selectClaims copies the claims at the given dot separated paths, keeping
+// their nesting.
+func selectClaims(claims map[string]interface{}, paths []string) map[string]interface{} {
+	data := map[string]interface{}{}
+
+	for _, path := range paths {
+		keys := strings.Split(path, ".")
+
+		var value interface{} = claims
+		found := true
+		for _, key := range keys {
+			object, ok := value.(map[string]interface{})
+			if !ok {
+				found = false
+				break
+			}
+			if value, ok = object[key]; !ok {
+				found = false
+				break
+			}
+		}
+		if !found {
+			continue
+		}
+
+		target := data
+		for _, key := range keys[:len(keys)-1] {
+			next, ok := target[key].(map[string]interface{})
+			if !ok {
+				next = map[string]interface{}{}
+				target[key] = next
+			}
+			target = next
+		}
+		target[keys[len(keys)-1]] = value
+	}
+
+	return data
+}
+
+func matchesETag(ifNoneMatch string, etag string) bool {
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == etag || candidate == "*" {
+			return true
+		}
 	}
+	return false
 }
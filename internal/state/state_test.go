@@ -16,6 +16,7 @@ package state
 
 import (
 	"context"
+	"net/http"
 	"net/http/httptest"
 	"testing"
 
@@ -99,3 +100,202 @@ func TestStateHandler_StateHandler(t *testing.T) {
 		})
 	}
 }
+
+func TestBootstrapTransformer_Transform(t *testing.T) {
+	c := *config.DefaultConfig()
+	c.Expressions.Principal = "data.sub"
+	c.State.Bootstrap = config.StateBootstrapConfig{
+		Claims:    []string{"name"},
+		ElementID: "kdex-state",
+		Permissions: []config.PermissionCheck{
+			{Action: "read", Resource: "page:/admin"},
+		},
+	}
+	c.Authz.Static.Permissions = []config.Permission{
+		{Action: "read", Principal: "admin", Resource: "page:/admin"},
+	}
+
+	tests := []struct {
+		name    string
+		session *session.SessionData
+		roles   []string
+		want    string
+	}{
+		{
+			name: "anonymous",
+			want: `<html><head><script type="application/json" id="kdex-state">{"principal":"","roles":[],"data":{},"permissions":[{"action":"read","allowed":false,"resource":"page:/admin"}]}</script></head><body></body></html>`,
+		},
+		{
+			name: "selected claims are escaped",
+			session: &session.SessionData{
+				Data: map[string]interface{}{
+					"name":   "</script><script>alert(1)</script>",
+					"roles":  []string{"admin"},
+					"secret": "internal",
+					"sub":    "test",
+				},
+			},
+			roles: []string{"admin"},
+			want:  `<html><head><script type="application/json" id="kdex-state">{"principal":"test","roles":["admin"],"data":{"name":"\u003c/script\u003e\u003cscript\u003ealert(1)\u003c/script\u003e"},"permissions":[{"action":"read","allowed":true,"resource":"page:/admin"}]}</script></head><body></body></html>`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			transformer := NewBootstrapTransformer(&c)
+
+			request := httptest.NewRequest("GET", "/", nil)
+			if tt.session != nil {
+				request = request.WithContext(context.WithValue(request.Context(), kctx.SessionDataKey, tt.session))
+			}
+			if tt.roles != nil {
+				request = request.WithContext(context.WithValue(request.Context(), kctx.UserRolesKey, tt.roles))
+			}
+
+			doc := util.ToDoc(`<html><head></head><body></body></html>`)
+			assert.NoError(t, transformer.Transform(&http.Response{Request: request}, doc))
+			assert.Equal(t, tt.want, util.FromDoc(doc))
+		})
+	}
+
+	t.Run("variant key follows the state", func(t *testing.T) {
+		transformer := NewBootstrapTransformer(&c)
+
+		anonymous := httptest.NewRequest("GET", "/", nil)
+		user := anonymous.WithContext(context.WithValue(anonymous.Context(), kctx.SessionDataKey, &session.SessionData{
+			Data: map[string]interface{}{"name": "Jane", "sub": "jane"},
+		}))
+
+		assert.NotEmpty(t, transformer.VariantKey(anonymous))
+		assert.NotEqual(t, transformer.VariantKey(anonymous), transformer.VariantKey(user))
+		assert.Equal(t, transformer.VariantKey(user), transformer.VariantKey(user))
+	})
+
+	t.Run("payload is evaluated once per request", func(t *testing.T) {
+		transformer := NewBootstrapTransformer(&c)
+
+		data := map[string]interface{}{"name": "Jane", "sub": "jane"}
+		request := httptest.NewRequest("GET", "/", nil)
+		request = request.WithContext(context.WithValue(request.Context(), kctx.MemoKey, &kctx.Memo{}))
+		request = request.WithContext(context.WithValue(request.Context(), kctx.SessionDataKey, &session.SessionData{Data: data}))
+
+		variantKey := transformer.VariantKey(request)
+		data["name"] = "Joan"
+
+		doc := util.ToDoc(`<html><head></head><body></body></html>`)
+		assert.NoError(t, transformer.Transform(&http.Response{Request: request}, doc))
+		assert.Contains(t, util.FromDoc(doc), `"name":"Jane"`)
+		assert.Equal(t, variantKey, transformer.VariantKey(request))
+	})
+}
+
+func TestStateHandler_projection(t *testing.T) {
+	claims := map[string]interface{}{
+		"address":            map[string]interface{}{"country": "CA", "street": "1 Main St"},
+		"email":              "jane@example.com",
+		"given_name":         "Jane",
+		"internal_id":        "42",
+		"picture":            "https://example.com/jane.png",
+		"preferred_username": "jane",
+		"roles":              []interface{}{"admin"},
+	}
+
+	tests := []struct {
+		name   string
+		config func(c *config.Config)
+		want   string
+	}{
+		{
+			name:   "all claims by default",
+			config: func(c *config.Config) {},
+			want:   `{"principal":"jane","roles":["admin"],"data":{"address":{"country":"CA","street":"1 Main St"},"email":"jane@example.com","given_name":"Jane","internal_id":"42","picture":"https://example.com/jane.png","preferred_username":"jane","roles":["admin"]}}`,
+		},
+		{
+			name: "allowlist",
+			config: func(c *config.Config) {
+				c.State.Claims = []string{"email", "address.country", "missing.claim"}
+			},
+			want: `{"principal":"jane","roles":["admin"],"data":{"address":{"country":"CA"},"email":"jane@example.com"}}`,
+		},
+		{
+			name: "expression",
+			config: func(c *config.Config) {
+				c.State.Expression = `{"name": data.given_name, "country": data.address.country}`
+			},
+			want: `{"principal":"jane","roles":["admin"],"data":{"country":"CA","name":"Jane"}}`,
+		},
+		{
+			name: "derived fields",
+			config: func(c *config.Config) {
+				c.State.Claims = []string{"email"}
+				c.State.Fields = map[string]string{
+					"avatar":       `data.picture`,
+					"display_name": `has(data.name) ? data.name : data.given_name`,
+					"broken":       `data.nope`,
+				}
+			},
+			want: `{"principal":"jane","roles":["admin"],"data":{"avatar":"https://example.com/jane.png","display_name":"Jane","email":"jane@example.com"}}`,
+		},
+		{
+			name: "permissions",
+			config: func(c *config.Config) {
+				c.State.Claims = []string{"email"}
+				c.State.Permissions = []config.PermissionCheck{
+					{Action: "read", Resource: "page:/admin"},
+					{Action: "write", Resource: "page:/admin"},
+				}
+				c.Authz.Static.Permissions = []config.Permission{
+					{Action: "read", Principal: "admin", Resource: "page:/admin"},
+				}
+			},
+			want: `{"principal":"jane","roles":["admin"],"data":{"email":"jane@example.com"},"permissions":[{"action":"read","allowed":true,"resource":"page:/admin"},{"action":"write","allowed":false,"resource":"page:/admin"}]}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := *config.DefaultConfig()
+			c.Expressions = config.ExpressionsConfig{Principal: "data.preferred_username", Roles: "data.roles"}
+			c.State = config.StateConfig{}
+			c.Authz.Static = config.StaticAuthzProviderConfig{}
+			tt.config(&c)
+
+			request := httptest.NewRequest("GET", "/~/state", nil)
+			request = request.WithContext(context.WithValue(request.Context(), kctx.SessionDataKey, &session.SessionData{Data: claims}))
+			request = request.WithContext(context.WithValue(request.Context(), kctx.UserRolesKey, []string{"admin"}))
+
+			recorder := httptest.NewRecorder()
+			NewStateHandler(&c).StateHandler()(recorder, request)
+
+			assert.Equal(t, tt.want, util.NormalizeString(recorder.Body.String()))
+			assert.Equal(t, "private", recorder.Header().Get("Cache-Control"))
+		})
+	}
+}
+
+func TestStateHandler_etag(t *testing.T) {
+	c := *config.DefaultConfig()
+	c.Expressions = config.ExpressionsConfig{Principal: "data.preferred_username", Roles: "data.roles"}
+	handler := NewStateHandler(&c).StateHandler()
+
+	recorder := httptest.NewRecorder()
+	handler(recorder, httptest.NewRequest("GET", "/~/state", nil))
+	etag := recorder.Header().Get("ETag")
+	assert.NotEmpty(t, etag)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+
+	request := httptest.NewRequest("GET", "/~/state", nil)
+	request.Header.Set("If-None-Match", etag)
+	recorder = httptest.NewRecorder()
+	handler(recorder, request)
+	assert.Equal(t, http.StatusNotModified, recorder.Code)
+	assert.Empty(t, recorder.Body.String())
+
+	request = httptest.NewRequest("GET", "/~/state", nil)
+	request = request.WithContext(context.WithValue(request.Context(), kctx.SessionDataKey, &session.SessionData{
+		Data: map[string]interface{}{"preferred_username": "jane"},
+	}))
+	request.Header.Set("If-None-Match", etag)
+	recorder = httptest.NewRecorder()
+	handler(recorder, request)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.NotEqual(t, etag, recorder.Header().Get("ETag"))
+}
@@ -0,0 +1,46 @@
+// Copyright 2025 KDex Tech
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"kdex.dev/proxy/internal/config"
+)
+
+var (
+	ErrAppNotFound = errors.New("app not found")
+)
+
+// AppStore persists the apps registered at runtime, keyed by alias. Set
+// reports whether the app was created rather than replaced.
+type AppStore interface {
+	Delete(ctx context.Context, alias string) error
+	Get(ctx context.Context, alias string) (*config.App, error)
+	List(ctx context.Context) ([]config.App, error)
+	Set(ctx context.Context, app config.App) (bool, error)
+}
+
+func NewAppStore(config *config.Config) (AppStore, error) {
+	switch config.Registry.Store {
+	case "memory":
+		return NewMemoryAppStore(), nil
+	case "file":
+		return NewFileAppStore(config.Registry.File)
+	}
+	return nil, fmt.Errorf("invalid store type: %s", config.Registry.Store)
+}
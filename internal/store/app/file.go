@@ -0,0 +1,143 @@
+// Copyright 2025 KDex Tech
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"kdex.dev/proxy/internal/config"
+)
+
+// fileAppStore keeps the apps in a JSON file. The file is re-read on every
+// access and replaced atomically on every change. Changes are only
+// serialized within the process, so the file must not be shared by replicas
+// that change it.
+type fileAppStore struct {
+	file string
+	mu   sync.Mutex
+}
+
+func NewFileAppStore(file string) (AppStore, error) {
+	if file == "" {
+		return nil, fmt.Errorf("file store requires a file")
+	}
+	return &fileAppStore{file: file}, nil
+}
+
+func (s *fileAppStore) Delete(ctx context.Context, alias string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	apps, err := s.read()
+	if err != nil {
+		return err
+	}
+	if _, ok := apps[alias]; !ok {
+		return ErrAppNotFound
+	}
+	delete(apps, alias)
+	return s.write(apps)
+}
+
+func (s *fileAppStore) Get(ctx context.Context, alias string) (*config.App, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	apps, err := s.read()
+	if err != nil {
+		return nil, err
+	}
+	app, ok := apps[alias]
+	if !ok {
+		return nil, ErrAppNotFound
+	}
+	return &app, nil
+}
+
+func (s *fileAppStore) List(ctx context.Context) ([]config.App, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	apps, err := s.read()
+	if err != nil {
+		return nil, err
+	}
+	return sortedApps(apps), nil
+}
+
+func (s *fileAppStore) Set(ctx context.Context, app config.App) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	apps, err := s.read()
+	if err != nil {
+		return false, err
+	}
+	_, exists := apps[app.Alias]
+	apps[app.Alias] = app
+	return !exists, s.write(apps)
+}
+
+func (s *fileAppStore) read() (map[string]config.App, error) {
+	apps := map[string]config.App{}
+
+	content, err := os.ReadFile(s.file)
+	if errors.Is(err, os.ErrNotExist) {
+		return apps, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading app store: %w", err)
+	}
+
+	var list []config.App
+	if err := json.Unmarshal(content, &list); err != nil {
+		return nil, fmt.Errorf("error parsing app store: %w", err)
+	}
+	for _, app := range list {
+		apps[app.Alias] = app
+	}
+	return apps, nil
+}
+
+func (s *fileAppStore) write(apps map[string]config.App) error {
+	content, err := json.MarshalIndent(sortedApps(apps), "", "  ")
+	if err != nil {
+		return fmt.Errorf("error encoding app store: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(s.file), filepath.Base(s.file)+".*")
+	if err != nil {
+		return fmt.Errorf("error writing app store: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(content); err != nil {
+		tmp.Close()
+		return fmt.Errorf("error writing app store: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("error writing app store: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), s.file); err != nil {
+		return fmt.Errorf("error writing app store: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,83 @@
+// Copyright 2025 KDex Tech
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package app
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	"kdex.dev/proxy/internal/config"
+)
+
+type memoryAppStore struct {
+	apps map[string]config.App
+	mu   sync.RWMutex
+}
+
+func NewMemoryAppStore() AppStore {
+	return &memoryAppStore{
+		apps: make(map[string]config.App),
+	}
+}
+
+func (s *memoryAppStore) Delete(ctx context.Context, alias string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.apps[alias]; !ok {
+		return ErrAppNotFound
+	}
+	delete(s.apps, alias)
+	return nil
+}
+
+func (s *memoryAppStore) Get(ctx context.Context, alias string) (*config.App, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	app, ok := s.apps[alias]
+	if !ok {
+		return nil, ErrAppNotFound
+	}
+	return &app, nil
+}
+
+func (s *memoryAppStore) List(ctx context.Context) ([]config.App, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return sortedApps(s.apps), nil
+}
+
+func (s *memoryAppStore) Set(ctx context.Context, app config.App) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, exists := s.apps[app.Alias]
+	s.apps[app.Alias] = app
+	return !exists, nil
+}
+
+func sortedApps(apps map[string]config.App) []config.App {
+	list := make([]config.App, 0, len(apps))
+	for _, app := range apps {
+		list = append(list, app)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Alias < list[j].Alias
+	})
+	return list
+}
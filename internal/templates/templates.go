@@ -0,0 +1,176 @@
+// Copyright 2025 KDex Tech
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package templates
+
+import (
+	"fmt"
+	"html/template"
+	"io"
+	"net/http"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"kdex.dev/proxy/internal/check"
+	"kdex.dev/proxy/internal/config"
+	kctx "kdex.dev/proxy/internal/context"
+)
+
+// Translator looks up localized messages for a request.
+type Translator interface {
+	Translate(r *http.Request, key string) string
+}
+
+// Library holds the templates loaded from the configured files so the
+// templates parsed from config can use them as partials. Templates are
+// executed with html/template escaping and a shared function library.
+type Library struct {
+	Checker    *check.Checker
+	Translator Translator
+	base       *template.Template
+}
+
+func NewLibrary(config *config.Config) (*Library, error) {
+	l := &Library{
+		Checker: check.NewChecker(config),
+	}
+
+	base := template.New("").Funcs(l.funcs(nil))
+	for _, pattern := range config.Templates.Files {
+		files, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid template pattern %q: %w", pattern, err)
+		}
+		if len(files) == 0 {
+			return nil, fmt.Errorf("no template files match %q", pattern)
+		}
+		if base, err = base.ParseFiles(files...); err != nil {
+			return nil, fmt.Errorf("error parsing template files: %w", err)
+		}
+	}
+	l.base = base
+
+	return l, nil
+}
+
+// Template is a parsed template whose functions are bound to the request it
+// is executed for. Executable copies are pooled and bound per execution, so
+// a copy's escaping is analysed once rather than on every execution.
+type Template struct {
+	pool sync.Pool
+}
+
+type boundTemplate struct {
+	request *request
+	tmpl    *template.Template
+}
+
+// request holds the request a copy is executing for.
+type request struct {
+	r *http.Request
+}
+
+// Parse parses text as the named template. It may refer to any template
+// defined in the library's files.
+func (l *Library) Parse(name string, text string) (*Template, error) {
+	base, err := l.base.Clone()
+	if err != nil {
+		return nil, err
+	}
+
+	tmpl, err := base.New(name).Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing template %s: %w", name, err)
+	}
+
+	t := &Template{}
+	t.pool.New = func() interface{} {
+		// The parsed template is never executed, so it can always be cloned
+		clone := template.Must(tmpl.Clone())
+		bound := &boundTemplate{request: &request{}, tmpl: clone}
+		clone.Funcs(l.funcs(bound.request))
+		return bound
+	}
+
+	return t, nil
+}
+
+// Execute runs tmpl with the functions bound to the request.
+func (l *Library) Execute(w io.Writer, tmpl *Template, r *http.Request, data interface{}) error {
+	bound := tmpl.pool.Get().(*boundTemplate)
+	bound.request.r = r
+	defer func() {
+		bound.request.r = nil
+		tmpl.pool.Put(bound)
+	}()
+
+	return bound.tmpl.Execute(w, data)
+}
+
+func (l *Library) funcs(req *request) template.FuncMap {
+	current := func() *http.Request {
+		if req == nil {
+			return nil
+		}
+		return req.r
+	}
+
+	return template.FuncMap{
+		"can": func(resource string, action string) bool {
+			r := current()
+			if r == nil || l.Checker == nil || l.Checker.PermissionProvider == nil {
+				return false
+			}
+			allowed, _ := l.Checker.Check(r.Context(), resource, action)
+			return allowed
+		},
+		"hasPrefix": strings.HasPrefix,
+		"pathBase":  path.Base,
+		"pathDir":   path.Dir,
+		"pathJoin":  path.Join,
+		"requestPath": func() string {
+			r := current()
+			if r == nil {
+				return ""
+			}
+			if p, ok := r.Context().Value(kctx.RequestPathKey).(string); ok {
+				return p
+			}
+			return r.URL.Path
+		},
+		"routeParam": func(name string) string {
+			r := current()
+			if r == nil {
+				return ""
+			}
+			params, _ := r.Context().Value(kctx.RouteParamsKey).(map[string]string)
+			return params[name]
+		},
+		"t": func(key string) string {
+			r := current()
+			if r == nil || l.Translator == nil {
+				return key
+			}
+			return l.Translator.Translate(r, key)
+		},
+		"trimSlash": func(s string) string {
+			return strings.TrimRight(s, "/")
+		},
+		"withSlash": func(s string) string {
+			return strings.TrimRight(s, "/") + "/"
+		},
+	}
+}
@@ -0,0 +1,150 @@
+// Copyright 2025 KDex Tech
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package templates
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"kdex.dev/proxy/internal/check"
+	"kdex.dev/proxy/internal/config"
+	kctx "kdex.dev/proxy/internal/context"
+	"kdex.dev/proxy/internal/permission"
+)
+
+type upperTranslator struct{}
+
+func (upperTranslator) Translate(r *http.Request, key string) string {
+	return "T(" + key + ")"
+}
+
+func TestLibrary_Execute(t *testing.T) {
+	dir := t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "link.html"), []byte(`{{ define "link" }}<a href="{{ .href }}">{{ .label }}</a>{{ end }}`), 0644))
+
+	c := *config.DefaultConfig()
+	c.Templates.Files = []string{filepath.Join(dir, "*.html")}
+
+	library, err := NewLibrary(&c)
+	assert.NoError(t, err)
+	library.Checker = &check.Checker{
+		PermissionProvider: &permission.StaticPermissionProvider{
+			Permissions: []config.Permission{{Resource: "page:/admin", Action: "read", Principal: "admin"}},
+		},
+	}
+	library.Translator = upperTranslator{}
+
+	tests := []struct {
+		name  string
+		text  string
+		data  interface{}
+		roles []string
+		want  string
+	}{
+		{
+			name: "partial from file",
+			text: `<li>{{ template "link" . }}</li>`,
+			data: map[string]interface{}{"href": "/docs", "label": "<b>Docs</b>"},
+			want: `<li><a href="/docs">&lt;b&gt;Docs&lt;/b&gt;</a></li>`,
+		},
+		{
+			name: "path helpers",
+			text: `{{ pathJoin "/docs" "intro" }} {{ pathBase "/docs/intro" }} {{ withSlash "/docs" }} {{ trimSlash "/docs/" }} {{ requestPath }}`,
+			want: `/docs/intro intro /docs/ /docs /current`,
+		},
+		{
+			name: "translation",
+			text: `{{ t "nav.home" }}`,
+			want: `T(nav.home)`,
+		},
+		{
+			name:  "permission allowed",
+			text:  `{{ if can "page:/admin" "read" }}admin{{ end }}`,
+			roles: []string{"admin"},
+			want:  `admin`,
+		},
+		{
+			name:  "permission denied",
+			text:  `{{ if can "page:/admin" "read" }}admin{{ end }}`,
+			roles: []string{"user"},
+			want:  ``,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpl, err := library.Parse(tt.name, tt.text)
+			assert.NoError(t, err)
+
+			req := httptest.NewRequest("GET", "/upstream", nil)
+			req = req.WithContext(context.WithValue(req.Context(), kctx.RequestPathKey, "/current"))
+			if tt.roles != nil {
+				req = req.WithContext(context.WithValue(req.Context(), kctx.UserRolesKey, tt.roles))
+			}
+
+			// Executing twice proves the parsed template stays reusable.
+			for range 2 {
+				var buf bytes.Buffer
+				assert.NoError(t, library.Execute(&buf, tmpl, req, tt.data))
+				assert.Equal(t, tt.want, buf.String())
+			}
+		})
+	}
+}
+
+func TestLibrary_Execute_concurrent(t *testing.T) {
+	c := *config.DefaultConfig()
+	library, err := NewLibrary(&c)
+	assert.NoError(t, err)
+
+	tmpl, err := library.Parse("path", `<a href="{{ requestPath }}">{{ . }}</a>`)
+	assert.NoError(t, err)
+
+	var wg sync.WaitGroup
+	for i := range 20 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			path := fmt.Sprintf("/page/%d", i)
+			req := httptest.NewRequest("GET", path, nil)
+
+			var buf bytes.Buffer
+			assert.NoError(t, library.Execute(&buf, tmpl, req, i))
+			assert.Equal(t, fmt.Sprintf(`<a href="%s">%d</a>`, path, i), buf.String())
+		}()
+	}
+	wg.Wait()
+}
+
+func TestLibrary_errors(t *testing.T) {
+	c := *config.DefaultConfig()
+	c.Templates.Files = []string{filepath.Join(t.TempDir(), "*.html")}
+	_, err := NewLibrary(&c)
+	assert.Error(t, err)
+
+	c.Templates.Files = nil
+	library, err := NewLibrary(&c)
+	assert.NoError(t, err)
+
+	_, err = library.Parse("broken", `{{ if }}`)
+	assert.Error(t, err)
+}
@@ -0,0 +1,39 @@
+// Copyright 2025 KDex Tech
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transform
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	ErrBudgetExceeded = errors.New("transform time budget exceeded")
+	ErrServeOriginal  = errors.New("serving original upstream content")
+)
+
+// TransformError records which transformer failed.
+type TransformError struct {
+	Transformer string
+	Err         error
+}
+
+func (e *TransformError) Error() string {
+	return fmt.Sprintf("transformer %s: %v", e.Transformer, e.Err)
+}
+
+func (e *TransformError) Unwrap() error {
+	return e.Err
+}
@@ -0,0 +1,137 @@
+// Copyright 2025 KDex Tech
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transform
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/andybalholm/cascadia"
+	"golang.org/x/net/html"
+	"kdex.dev/proxy/internal/config"
+	kctx "kdex.dev/proxy/internal/context"
+	"kdex.dev/proxy/internal/dom"
+	"kdex.dev/proxy/internal/util"
+)
+
+const (
+	// OPT_OUT_META_NAME is the name of the meta element upstream pages use to
+	// opt out of transformation. Its content is either "none" or a comma
+	// separated list of transformer names to skip.
+	OPT_OUT_META_NAME = "kdex-transform"
+)
+
+// ScopedTransformer runs the wrapped transformer only for the configured
+// paths and content markers, and only when the page hasn't opted out.
+type ScopedTransformer struct {
+	Name         string
+	OnError      string
+	Transformer  Transformer
+	excludePaths []string
+	markers      []cascadia.Sel
+	paths        []string
+}
+
+func NewScopedTransformer(transformer Transformer, c config.TransformerConfig) (*ScopedTransformer, error) {
+	if !ValidOnError(c.OnError) {
+		return nil, fmt.Errorf("invalid on_error %q for transformer %s", c.OnError, c.Name)
+	}
+
+	markers := make([]cascadia.Sel, 0, len(c.Markers))
+	for _, marker := range c.Markers {
+		sel, err := cascadia.Parse(marker)
+		if err != nil {
+			return nil, fmt.Errorf("invalid marker %q for transformer %s: %w", marker, c.Name, err)
+		}
+		markers = append(markers, sel)
+	}
+
+	return &ScopedTransformer{
+		Name:         c.Name,
+		OnError:      c.OnError,
+		Transformer:  transformer,
+		excludePaths: c.ExcludePaths,
+		markers:      markers,
+		paths:        c.Paths,
+	}, nil
+}
+
+func (t *ScopedTransformer) Transform(r *http.Response, doc *html.Node) error {
+	if !t.Applies(r, doc) {
+		return nil
+	}
+	return t.Transformer.Transform(r, doc)
+}
+
+func (t *ScopedTransformer) VariantKey(r *http.Request) string {
+	if varier, ok := t.Transformer.(Varier); ok {
+		return varier.VariantKey(r)
+	}
+	return ""
+}
+
+// Applies reports whether the transformer is in scope for the response.
+func (t *ScopedTransformer) Applies(r *http.Response, doc *html.Node) bool {
+	if OptedOut(doc, t.Name) {
+		return false
+	}
+
+	path := r.Request.URL.Path
+	if p, ok := r.Request.Context().Value(kctx.RequestPathKey).(string); ok {
+		path = p
+	}
+
+	for _, pattern := range t.excludePaths {
+		if util.MatchPath(pattern, path) {
+			return false
+		}
+	}
+
+	if len(t.paths) > 0 && !slices.ContainsFunc(t.paths, func(pattern string) bool {
+		return util.MatchPath(pattern, path)
+	}) {
+		return false
+	}
+
+	if len(t.markers) > 0 && !slices.ContainsFunc(t.markers, func(sel cascadia.Sel) bool {
+		return cascadia.Query(doc, sel) != nil
+	}) {
+		return false
+	}
+
+	return true
+}
+
+// OptedOut reports whether the document carries an opt-out meta element for
+// all transformers or for the named one.
+func OptedOut(doc *html.Node, name string) bool {
+	metaNode := dom.FindElementByName("meta", doc, func(n *html.Node) bool {
+		return dom.GetAttribute(n, "name") == OPT_OUT_META_NAME
+	})
+	if metaNode == nil {
+		return false
+	}
+
+	for _, value := range strings.Split(dom.GetAttribute(metaNode, "content"), ",") {
+		value = strings.TrimSpace(value)
+		if value == "none" || value == name {
+			return true
+		}
+	}
+
+	return false
+}
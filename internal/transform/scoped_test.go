@@ -0,0 +1,135 @@
+// Copyright 2025 KDex Tech
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transform
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/html"
+	"kdex.dev/proxy/internal/config"
+	kctx "kdex.dev/proxy/internal/context"
+	"kdex.dev/proxy/internal/util"
+)
+
+type countingTransformer struct {
+	calls int
+}
+
+func (t *countingTransformer) Transform(r *http.Response, doc *html.Node) error {
+	t.calls++
+	return nil
+}
+
+func TestScopedTransformer_Transform(t *testing.T) {
+	tests := []struct {
+		name   string
+		config config.TransformerConfig
+		path   string
+		doc    string
+		want   int
+	}{
+		{
+			name:   "unscoped",
+			config: config.TransformerConfig{Name: "navigation"},
+			path:   "/",
+			doc:    `<html><body></body></html>`,
+			want:   1,
+		},
+		{
+			name:   "path matching",
+			config: config.TransformerConfig{Name: "navigation", Paths: []string{"/docs/*"}},
+			path:   "/docs/intro",
+			doc:    `<html><body></body></html>`,
+			want:   1,
+		},
+		{
+			name:   "path not matching",
+			config: config.TransformerConfig{Name: "navigation", Paths: []string{"/docs/*"}},
+			path:   "/blog",
+			doc:    `<html><body></body></html>`,
+			want:   0,
+		},
+		{
+			name:   "excluded path",
+			config: config.TransformerConfig{Name: "navigation", ExcludePaths: []string{"/print/*"}},
+			path:   "/print/page",
+			doc:    `<html><body></body></html>`,
+			want:   0,
+		},
+		{
+			name:   "marker present",
+			config: config.TransformerConfig{Name: "navigation", Markers: []string{"nav.main"}},
+			path:   "/",
+			doc:    `<html><body><nav class="main"></nav></body></html>`,
+			want:   1,
+		},
+		{
+			name:   "marker missing",
+			config: config.TransformerConfig{Name: "navigation", Markers: []string{"nav.main"}},
+			path:   "/",
+			doc:    `<html><body><nav></nav></body></html>`,
+			want:   0,
+		},
+		{
+			name:   "opted out of everything",
+			config: config.TransformerConfig{Name: "navigation"},
+			path:   "/",
+			doc:    `<html><head><meta name="kdex-transform" content="none"></head><body></body></html>`,
+			want:   0,
+		},
+		{
+			name:   "opted out of this transformer",
+			config: config.TransformerConfig{Name: "navigation"},
+			path:   "/",
+			doc:    `<html><head><meta name="description" content="x"><meta name="kdex-transform" content="app, navigation"></head><body></body></html>`,
+			want:   0,
+		},
+		{
+			name:   "opted out of another transformer",
+			config: config.TransformerConfig{Name: "navigation"},
+			path:   "/",
+			doc:    `<html><head><meta name="kdex-transform" content="app"></head><body></body></html>`,
+			want:   1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			counter := &countingTransformer{}
+			scoped, err := NewScopedTransformer(counter, tt.config)
+			assert.NoError(t, err)
+
+			req := httptest.NewRequest("GET", "/upstream", nil)
+			req = req.WithContext(context.WithValue(req.Context(), kctx.RequestPathKey, tt.path))
+
+			err = scoped.Transform(&http.Response{Request: req}, util.ToDoc(tt.doc))
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, counter.calls)
+		})
+	}
+}
+
+func TestNewScopedTransformer_invalidMarker(t *testing.T) {
+	_, err := NewScopedTransformer(&countingTransformer{}, config.TransformerConfig{Name: "app", Markers: []string{"div["}})
+	assert.Error(t, err)
+}
+
+func TestNewScopedTransformer_invalidOnError(t *testing.T) {
+	_, err := NewScopedTransformer(&countingTransformer{}, config.TransformerConfig{Name: "app", OnError: "ignore"})
+	assert.Error(t, err)
+}
@@ -15,25 +15,174 @@
 package transform
 
 import (
+	"context"
+	"fmt"
+	"log"
 	"net/http"
+	"strings"
+	"time"
 
 	"golang.org/x/net/html"
+	"kdex.dev/proxy/internal/dom"
+)
+
+const (
+	OnErrorFail     = "fail"
+	OnErrorOriginal = "original"
+	OnErrorSkip     = "skip"
 )
 
 type Transformer interface {
 	Transform(r *http.Response, doc *html.Node) error
 }
 
+// Varier is implemented by transformers whose output depends on the request
+// beyond the upstream content and the config, such as on the user. The key
+// identifies the variant produced for the request; it is empty when the
+// output doesn't vary.
+type Varier interface {
+	VariantKey(r *http.Request) string
+}
+
 type AggregatedTransformer struct {
 	Transformer
 	Transformers []Transformer
+	// OnError is the policy for transformers that don't declare their own.
+	OnError string
+	// Timeout bounds the time all transformers may spend on one response.
+	Timeout time.Duration
 }
 
 func (t *AggregatedTransformer) Transform(r *http.Response, doc *html.Node) error {
+	var deadline time.Time
+	if t.Timeout > 0 {
+		deadline = time.Now().Add(t.Timeout)
+	}
+
 	for _, transformer := range t.Transformers {
-		if err := transformer.Transform(r, doc); err != nil {
-			return err
+		name, policy := t.describe(transformer)
+
+		err := run(transformer, r, doc, deadline)
+		if err == nil {
+			continue
+		}
+
+		log.Printf("Transformer %s failed (policy %s): %v", name, policy, err)
+
+		// Once the budget is spent the remaining transformers can't run
+		// either, so the page can't be completed.
+		if err == ErrBudgetExceeded && policy == OnErrorSkip {
+			policy = OnErrorOriginal
+		}
+
+		switch policy {
+		case OnErrorSkip:
+			continue
+		case OnErrorOriginal:
+			return &TransformError{Transformer: name, Err: fmt.Errorf("%w: %w", ErrServeOriginal, err)}
+		default:
+			return &TransformError{Transformer: name, Err: err}
 		}
 	}
 	return nil
 }
+
+// VariantKey combines the variant keys of the transformers.
+func (t *AggregatedTransformer) VariantKey(r *http.Request) string {
+	keys := []string{}
+	for _, transformer := range t.Transformers {
+		if varier, ok := transformer.(Varier); ok {
+			if key := varier.VariantKey(r); key != "" {
+				keys = append(keys, key)
+			}
+		}
+	}
+	return strings.Join(keys, "|")
+}
+
+// ValidOnError reports whether policy is a known error policy. The empty
+// policy defers to the default.
+func ValidOnError(policy string) bool {
+	switch policy {
+	case "", OnErrorFail, OnErrorOriginal, OnErrorSkip:
+		return true
+	}
+	return false
+}
+
+func (t *AggregatedTransformer) describe(transformer Transformer) (string, string) {
+	name := fmt.Sprintf("%T", transformer)
+	policy := t.OnError
+
+	if scoped, ok := transformer.(*ScopedTransformer); ok {
+		name = scoped.Name
+		if scoped.OnError != "" {
+			policy = scoped.OnError
+		}
+	}
+
+	if policy == "" {
+		policy = OnErrorFail
+	}
+
+	return name, policy
+}
+
+// run applies the transformer to copies of the response and the document,
+// which replace the originals only when it succeeds. A transformer that
+// fails, panics or runs out of budget leaves the page as it found it.
+func run(transformer Transformer, r *http.Response, doc *html.Node, deadline time.Time) error {
+	remaining := time.Until(deadline)
+	if !deadline.IsZero() && remaining <= 0 {
+		return ErrBudgetExceeded
+	}
+
+	response := *r
+	response.Header = r.Header.Clone()
+	work := dom.Clone(doc)
+
+	commit := func(err error) error {
+		if err == nil {
+			r.Header = response.Header
+			dom.ReplaceChildren(doc, work)
+		}
+		return err
+	}
+
+	if deadline.IsZero() {
+		return commit(safeTransform(transformer, &response, work))
+	}
+
+	// With a budget the transformer also gets a context ending with it, so
+	// one that runs out of time stops its requests.
+	if r.Request != nil {
+		ctx, cancel := context.WithDeadline(r.Request.Context(), deadline)
+		defer cancel()
+		response.Request = r.Request.WithContext(ctx)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- safeTransform(transformer, &response, work)
+	}()
+
+	timer := time.NewTimer(remaining)
+	defer timer.Stop()
+
+	select {
+	case err := <-done:
+		return commit(err)
+	case <-timer.C:
+		return ErrBudgetExceeded
+	}
+}
+
+func safeTransform(transformer Transformer, r *http.Response, doc *html.Node) (err error) {
+	defer func() {
+		if rec := recover(); rec != nil {
+			err = fmt.Errorf("panic: %v", rec)
+		}
+	}()
+
+	return transformer.Transform(r, doc)
+}
@@ -0,0 +1,207 @@
+// Copyright 2025 KDex Tech
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package transform
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/html"
+	"kdex.dev/proxy/internal/config"
+	"kdex.dev/proxy/internal/util"
+)
+
+type funcTransformer func(r *http.Response, doc *html.Node) error
+
+func (f funcTransformer) Transform(r *http.Response, doc *html.Node) error {
+	return f(r, doc)
+}
+
+var (
+	failing = funcTransformer(func(r *http.Response, doc *html.Node) error {
+		return errors.New("boom")
+	})
+	panicking = funcTransformer(func(r *http.Response, doc *html.Node) error {
+		panic("boom")
+	})
+	slow = funcTransformer(func(r *http.Response, doc *html.Node) error {
+		time.Sleep(200 * time.Millisecond)
+		return nil
+	})
+)
+
+func scoped(t *testing.T, transformer Transformer, onError string) Transformer {
+	s, err := NewScopedTransformer(transformer, config.TransformerConfig{Name: "test", OnError: onError})
+	assert.NoError(t, err)
+	return s
+}
+
+func TestAggregatedTransformer_Transform(t *testing.T) {
+	tests := []struct {
+		name         string
+		onError      string
+		timeout      time.Duration
+		transformer  func(t *testing.T) Transformer
+		wantErr      bool
+		wantOriginal bool
+		wantCalls    int
+	}{
+		{
+			name:        "success",
+			transformer: func(t *testing.T) Transformer { return scoped(t, &countingTransformer{}, "") },
+			wantCalls:   1,
+		},
+		{
+			name:        "fail by default",
+			transformer: func(t *testing.T) Transformer { return scoped(t, failing, "") },
+			wantErr:     true,
+		},
+		{
+			name:        "skip",
+			onError:     OnErrorSkip,
+			transformer: func(t *testing.T) Transformer { return scoped(t, failing, "") },
+			wantCalls:   1,
+		},
+		{
+			name:         "original",
+			onError:      OnErrorOriginal,
+			transformer:  func(t *testing.T) Transformer { return scoped(t, failing, "") },
+			wantErr:      true,
+			wantOriginal: true,
+		},
+		{
+			name:        "transformer policy overrides default",
+			onError:     OnErrorFail,
+			transformer: func(t *testing.T) Transformer { return scoped(t, failing, OnErrorSkip) },
+			wantCalls:   1,
+		},
+		{
+			name:        "panic is recovered",
+			onError:     OnErrorSkip,
+			transformer: func(t *testing.T) Transformer { return scoped(t, panicking, "") },
+			wantCalls:   1,
+		},
+		{
+			name:         "budget exceeded serves original even when skipping",
+			onError:      OnErrorSkip,
+			timeout:      20 * time.Millisecond,
+			transformer:  func(t *testing.T) Transformer { return scoped(t, slow, "") },
+			wantErr:      true,
+			wantOriginal: true,
+		},
+		{
+			name:        "within budget",
+			timeout:     time.Second,
+			transformer: func(t *testing.T) Transformer { return scoped(t, &countingTransformer{}, "") },
+			wantCalls:   1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			counter := &countingTransformer{}
+			aggregated := &AggregatedTransformer{
+				OnError:      tt.onError,
+				Timeout:      tt.timeout,
+				Transformers: []Transformer{tt.transformer(t), counter},
+			}
+
+			req := httptest.NewRequest("GET", "/", nil)
+			err := aggregated.Transform(&http.Response{Request: req}, util.ToDoc(`<html><body></body></html>`))
+
+			if tt.wantErr {
+				assert.Error(t, err)
+				var transformErr *TransformError
+				assert.ErrorAs(t, err, &transformErr)
+				assert.Equal(t, "test", transformErr.Transformer)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tt.wantOriginal, errors.Is(err, ErrServeOriginal))
+			assert.Equal(t, tt.wantCalls, counter.calls)
+		})
+	}
+}
+
+func TestAggregatedTransformer_Transform_budget(t *testing.T) {
+	canceled := make(chan struct{})
+	stubborn := funcTransformer(func(r *http.Response, doc *html.Node) error {
+		<-r.Request.Context().Done()
+		close(canceled)
+
+		// Keeps mutating its document after the budget is spent
+		for i := 0; i < 100; i++ {
+			doc.AppendChild(&html.Node{Type: html.CommentNode, Data: "late"})
+			r.Header.Set("X-Late", "true")
+		}
+		return nil
+	})
+	adding := funcTransformer(func(r *http.Response, doc *html.Node) error {
+		doc.AppendChild(&html.Node{Type: html.CommentNode, Data: "added"})
+		r.Header.Set("X-Added", "true")
+		return nil
+	})
+
+	aggregated := &AggregatedTransformer{
+		OnError:      OnErrorOriginal,
+		Timeout:      20 * time.Millisecond,
+		Transformers: []Transformer{adding, stubborn},
+	}
+
+	r := &http.Response{Header: http.Header{}, Request: httptest.NewRequest("GET", "/", nil)}
+	doc := util.ToDoc(`<html><body></body></html>`)
+	err := aggregated.Transform(r, doc)
+	assert.ErrorIs(t, err, ErrBudgetExceeded)
+
+	select {
+	case <-canceled:
+	case <-time.After(time.Second):
+		t.Fatal("transformer context not canceled")
+	}
+
+	assert.Equal(t, `<html><head></head><body></body></html><!--added-->`, util.FromDoc(doc))
+	assert.Equal(t, "true", r.Header.Get("X-Added"))
+	assert.Empty(t, r.Header.Get("X-Late"))
+}
+
+func TestAggregatedTransformer_Transform_skipRollsBack(t *testing.T) {
+	failing := funcTransformer(func(r *http.Response, doc *html.Node) error {
+		doc.AppendChild(&html.Node{Type: html.CommentNode, Data: "partial"})
+		r.Header.Set("X-Partial", "true")
+		return errors.New("failed halfway")
+	})
+	panicking := funcTransformer(func(r *http.Response, doc *html.Node) error {
+		doc.AppendChild(&html.Node{Type: html.CommentNode, Data: "partial"})
+		panic("failed halfway")
+	})
+	adding := funcTransformer(func(r *http.Response, doc *html.Node) error {
+		doc.AppendChild(&html.Node{Type: html.CommentNode, Data: "added"})
+		return nil
+	})
+
+	aggregated := &AggregatedTransformer{
+		OnError:      OnErrorSkip,
+		Transformers: []Transformer{failing, adding, panicking},
+	}
+
+	r := &http.Response{Header: http.Header{}, Request: httptest.NewRequest("GET", "/", nil)}
+	doc := util.ToDoc(`<html><body></body></html>`)
+	assert.NoError(t, aggregated.Transform(r, doc))
+	assert.Equal(t, `<html><head></head><body></body></html><!--added-->`, util.FromDoc(doc))
+	assert.Empty(t, r.Header.Get("X-Partial"))
+}
@@ -59,6 +59,82 @@ func Keys[K comparable, V any](m map[K]V) []K {
 	return keys
 }
 
+// MatchPath reports whether path matches pattern. A pattern ending in "*"
+// matches by prefix, any other pattern must match exactly.
+func MatchPath(pattern string, path string) bool {
+	if strings.HasSuffix(pattern, "*") {
+		return strings.HasPrefix(path, pattern[:len(pattern)-1])
+	}
+	return pattern == path
+}
+
+// MatchRoute matches the leading segments of path against a route pattern
+// whose segments may be named parameters such as {id}. It returns the
+// captured parameters and the unmatched rest of path, which is empty or
+// starts with "/".
+func MatchRoute(pattern string, path string) (map[string]string, string, bool) {
+	params := map[string]string{}
+	rest := path
+
+	for _, segment := range strings.Split(strings.Trim(pattern, "/"), "/") {
+		if segment == "" {
+			continue
+		}
+		if !strings.HasPrefix(rest, "/") {
+			return nil, "", false
+		}
+
+		rest = rest[1:]
+		end := strings.IndexByte(rest, '/')
+		if end < 0 {
+			end = len(rest)
+		}
+		value := rest[:end]
+		rest = rest[end:]
+
+		if name, ok := routeParam(segment); ok {
+			if value == "" {
+				return nil, "", false
+			}
+			params[name] = value
+		} else if value != segment {
+			return nil, "", false
+		}
+	}
+
+	return params, rest, true
+}
+
+// ExpandRoute replaces the named parameters of a route pattern with their
+// values. It reports false when a parameter has no value.
+func ExpandRoute(pattern string, params map[string]string) (string, bool) {
+	segments := strings.Split(pattern, "/")
+	for i, segment := range segments {
+		name, ok := routeParam(segment)
+		if !ok {
+			continue
+		}
+		value, ok := params[name]
+		if !ok {
+			return "", false
+		}
+		segments[i] = value
+	}
+	return strings.Join(segments, "/"), true
+}
+
+// IsRoutePattern reports whether pattern has named parameters.
+func IsRoutePattern(pattern string) bool {
+	return strings.Contains(pattern, "{")
+}
+
+func routeParam(segment string) (string, bool) {
+	if len(segment) > 2 && strings.HasPrefix(segment, "{") && strings.HasSuffix(segment, "}") {
+		return segment[1 : len(segment)-1], true
+	}
+	return "", false
+}
+
 func NormalizeString(s string) string {
 	s = strings.ReplaceAll(s, "\n", "")
 	s = strings.ReplaceAll(s, "\r", "")
@@ -67,6 +143,19 @@ func NormalizeString(s string) string {
 	return s
 }
 
+// PrivateCacheControl marks a Cache-Control value private, replacing public,
+// so responses meant for one user stay out of shared caches.
+func PrivateCacheControl(value string) string {
+	directives := []string{"private"}
+	for _, directive := range strings.Split(value, ",") {
+		directive = strings.TrimSpace(directive)
+		if directive != "" && !strings.EqualFold(directive, "public") && !strings.EqualFold(directive, "private") {
+			directives = append(directives, directive)
+		}
+	}
+	return strings.Join(directives, ", ")
+}
+
 func RandStringBytes(length int) string {
 	b := make([]byte, length)
 	for i := range b {